@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DefBuckets are upper boundaries for durations in seconds, from 5 ms up to
+// 10 s, as a general purpose default. The values match the default of the
+// Prometheus client libraries.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// LowLatencyBuckets are upper boundaries for durations in seconds, from 100 µs
+// up to 1 s, for fast operations such as cache lookups and local calls.
+var LowLatencyBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// LinearBuckets returns count upper boundaries, with the lowest at start, each
+// width apart. LinearBuckets panics when count is less than one, or when
+// width is not positive.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 {
+		panic("metrics: bucket count less than one")
+	}
+	if !(width > 0) || math.IsInf(width, 0) || math.IsInf(start, 0) || math.IsNaN(start) {
+		panic("metrics: linear buckets need a finite start and a positive width")
+	}
+
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBuckets returns count upper boundaries, with the lowest at start,
+// each a factor more than its predecessor. ExponentialBuckets panics when
+// count is less than one, when start is not positive, or when factor is not
+// greater than one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 {
+		panic("metrics: bucket count less than one")
+	}
+	if !(start > 0) || math.IsInf(start, 0) || !(factor > 1) || math.IsInf(factor, 0) {
+		panic("metrics: exponential buckets need a positive start and a factor greater than one")
+	}
+
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// ExponentialBucketsRange returns count upper boundaries, from min up to max,
+// with a constant factor in between. ExponentialBucketsRange panics when count
+// is less than two, when min is not positive, or when max is not greater than
+// min.
+func ExponentialBucketsRange(min, max float64, count int) []float64 {
+	if count < 2 {
+		panic("metrics: bucket count for range less than two")
+	}
+	if !(min > 0) || !(max > min) || math.IsInf(max, 0) {
+		panic("metrics: exponential bucket range needs 0 < min < max")
+	}
+
+	factor := math.Pow(max/min, 1/float64(count-1))
+	bounds := ExponentialBuckets(min, factor, count)
+	bounds[count-1] = max // prevent rounding error
+	return bounds
+}
+
+// ValidateBuckets reports any changes from the registration of a histogram
+// with bounds. Histograms drop not-a-number (NaN) and infinity values, as well
+// as duplicates, and bounds get sorted in ascending order. The return is nil
+// when bounds is in use as is. Such validation may prevent mistakes with hand
+// typed bucket lists, e.g., in a test with:
+//
+//	if err := metrics.ValidateBuckets(MyBuckets...); err != nil {
+//		t.Error(err)
+//	}
+func ValidateBuckets(bounds ...float64) error {
+	var issues []string
+	seen := make(map[float64]int, len(bounds))
+	maxIndex := -1 // highest bound so far
+	for i, f := range bounds {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			issues = append(issues, fmt.Sprintf("bound %d (%g) dropped", i, f))
+			continue
+		}
+		if j, ok := seen[f]; ok {
+			issues = append(issues, fmt.Sprintf("bound %d (%g) dropped as duplicate of bound %d", i, f, j))
+			continue
+		}
+		seen[f] = i
+
+		if maxIndex >= 0 && f < bounds[maxIndex] {
+			issues = append(issues, fmt.Sprintf("bound %d (%g) reordered before bound %d (%g)", i, f, maxIndex, bounds[maxIndex]))
+		} else {
+			maxIndex = i
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+	return errors.New("metrics: histogram buckets: " + strings.Join(issues, ", "))
+}
+
+// Bucket search strategies, as resolved from the bucket bounds.
+const (
+	searchBinary = iota
+	searchScan
+	searchLinear
+	searchExponential
+)
+
+// ScanMax is the bucket count limit for searchScan.
+const scanMax = 8
+
+// BucketSearch resolves the bucket index of values. The index of positive
+// infinity, which includes not-a-number (NaN), is the number of bounds. The
+// results match sort.SearchFloat64s for all strategies.
+type bucketSearch struct {
+	kind int
+
+	// linear layout has bounds at offset + i/scale
+	offset, scale float64
+
+	// exponential layout has the first candidate per binary exponent
+	minExp   int
+	expIndex []int32
+}
+
+func newBucketSearch(bounds []float64) bucketSearch {
+	n := len(bounds)
+	if n <= scanMax {
+		return bucketSearch{kind: searchScan}
+	}
+
+	width := (bounds[n-1] - bounds[0]) / float64(n-1)
+	linear := true
+	for i, f := range bounds {
+		// any deviation is corrected at the cost of speed
+		if math.Abs(f-(bounds[0]+float64(i)*width)) > width/1024 {
+			linear = false
+			break
+		}
+	}
+	if linear {
+		return bucketSearch{kind: searchLinear, offset: bounds[0], scale: 1 / width}
+	}
+
+	if bounds[0] <= 0 || math.IsInf(bounds[n-1], 0) {
+		return bucketSearch{kind: searchBinary}
+	}
+	// growth factor per bucket
+	factor := math.Pow(bounds[n-1]/bounds[0], 1/float64(n-1))
+	// limit the scan to 8 bounds per binary exponent
+	if !(factor >= math.Pow(2, 1.0/scanMax)) {
+		return bucketSearch{kind: searchBinary}
+	}
+	for i, f := range bounds {
+		if math.Abs(f/(bounds[0]*math.Pow(factor, float64(i)))-1) > 1.0/1024 {
+			return bucketSearch{kind: searchBinary}
+		}
+	}
+
+	minExp := floatExp(bounds[0])
+	s := bucketSearch{
+		kind:     searchExponential,
+		minExp:   minExp,
+		expIndex: make([]int32, floatExp(bounds[n-1])-minExp+1),
+	}
+	for i := range s.expIndex {
+		// lowest value with the exponent
+		low := math.Float64frombits(uint64(minExp+i) << 52)
+		s.expIndex[i] = int32(sort.SearchFloat64s(bounds, low))
+	}
+	return s
+}
+
+// FloatExp returns the biased exponent of a positive f.
+func floatExp(f float64) int {
+	return int(math.Float64bits(f) >> 52)
+}
+
+// Index returns the bucket of value.
+func (s *bucketSearch) index(bounds []float64, value float64) int {
+	switch s.kind {
+	case searchScan:
+		// count without branches on the bounds
+		var i int
+		for _, f := range bounds {
+			if !(f >= value) {
+				i++
+			}
+		}
+		return i
+
+	case searchLinear:
+		n := len(bounds)
+		i := n // NaN included
+		if f := (value - s.offset) * s.scale; f <= 0 {
+			i = 0
+		} else if f < float64(n) {
+			i = int(f)
+		}
+		// correct estimate for rounding errors
+		for i > 0 && value <= bounds[i-1] {
+			i--
+		}
+		for i < n && value > bounds[i] {
+			i++
+		}
+		return i
+
+	case searchExponential:
+		if !(value > bounds[0]) {
+			if value <= bounds[0] {
+				return 0
+			}
+			return len(bounds) // NaN
+		}
+		e := floatExp(value) - s.minExp
+		if e >= len(s.expIndex) {
+			return len(bounds) // beyond last exponent
+		}
+		i := int(s.expIndex[e])
+		for i < len(bounds) && value > bounds[i] {
+			i++
+		}
+		return i
+	}
+
+	return sort.SearchFloat64s(bounds, value)
+}
@@ -0,0 +1,93 @@
+package metrics_test
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func ExampleLinearBuckets() {
+	fmt.Println(metrics.LinearBuckets(10, 5, 4))
+	// Output: [10 15 20 25]
+}
+
+func ExampleExponentialBuckets() {
+	fmt.Println(metrics.ExponentialBuckets(0.5, 2, 5))
+	// Output: [0.5 1 2 4 8]
+}
+
+func ExampleExponentialBucketsRange() {
+	fmt.Println(metrics.ExponentialBucketsRange(0.5, 8, 5))
+	// Output: [0.5 1 2 4 8]
+}
+
+func ExampleValidateBuckets() {
+	err := metrics.ValidateBuckets(0.1, 0.5, 0.25, 1, 0.5, math.Inf(1))
+	fmt.Println(err)
+	// Output: metrics: histogram buckets: bound 2 (0.25) reordered before bound 1 (0.5), bound 4 (0.5) dropped as duplicate of bound 1, bound 5 (+Inf) dropped
+}
+
+func TestBucketPresets(t *testing.T) {
+	for name, bounds := range map[string][]float64{
+		"DefBuckets":        metrics.DefBuckets,
+		"LowLatencyBuckets": metrics.LowLatencyBuckets,
+	} {
+		if err := metrics.ValidateBuckets(bounds...); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestBucketGenerators(t *testing.T) {
+	bounds := metrics.ExponentialBucketsRange(0.001, 10, 20)
+	if err := metrics.ValidateBuckets(bounds...); err != nil {
+		t.Error(err)
+	}
+	if len(bounds) != 20 || bounds[0] != 0.001 || bounds[19] != 10 {
+		t.Errorf("got exponential range %v, want 20 bounds from 0.001 to 10", bounds)
+	}
+
+	h := metrics.NewRegister().MustHistogram("h", "", metrics.LinearBuckets(-1, 0.1, 21)...)
+	if len(h.BucketBounds) != 21 {
+		t.Errorf("got %d linear bounds registered, want 21", len(h.BucketBounds))
+	}
+
+	for _, f := range []func(){
+		func() { metrics.LinearBuckets(0, 1, 0) },
+		func() { metrics.LinearBuckets(0, 0, 3) },
+		func() { metrics.LinearBuckets(math.NaN(), 1, 3) },
+		func() { metrics.ExponentialBuckets(0, 2, 3) },
+		func() { metrics.ExponentialBuckets(1, 1, 3) },
+		func() { metrics.ExponentialBucketsRange(1, 10, 1) },
+		func() { metrics.ExponentialBucketsRange(10, 1, 3) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic on invalid arguments")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestValidateBucketsNormalization(t *testing.T) {
+	golden := [][]float64{
+		{},
+		{1},
+		{3, 2, 1},
+		{1, 1, math.NaN(), 0, math.Copysign(0, -1)},
+		{1, 5, 2, 3, 2},
+	}
+	for _, bounds := range golden {
+		h := metrics.NewRegister().MustHistogram("h", "", bounds...)
+		changed := !reflect.DeepEqual(h.BucketBounds, bounds) && len(bounds) != 0
+		if err := metrics.ValidateBuckets(bounds...); (err != nil) != changed {
+			t.Errorf("%v registered as %v, got validation error %v", bounds, h.BucketBounds, err)
+		}
+	}
+}
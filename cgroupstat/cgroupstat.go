@@ -0,0 +1,307 @@
+// Package cgroupstat provides container resource statistics to the default
+// registry. Readings come from the control group of the process, with support
+// for both cgroup v1 and cgroup v2 (a.k.a. the unified hierarchy).
+package cgroupstat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Container Samples
+var (
+	CPULimit         = metrics.MustRealSample("cgroup_cpu_limit_cores", "CPU quota per period, i.e., the number of cores available.")
+	CPUUsage         = metrics.MustCounterSample("cgroup_cpu_usage_seconds_total", "Total CPU time consumed by the control group.")
+	CPUPeriods       = metrics.MustCounterSample("cgroup_cpu_periods_total", "Number of enforcement periods elapsed.")
+	CPUThrottled     = metrics.MustCounterSample("cgroup_cpu_throttled_periods_total", "Number of enforcement periods with throttling.")
+	CPUThrottledTime = metrics.MustCounterSample("cgroup_cpu_throttled_seconds_total", "Total time throttled.")
+	MemoryLimit      = metrics.MustRealSample("cgroup_memory_limit_bytes", "Memory usage limit.")
+	MemoryUsage      = metrics.MustRealSample("cgroup_memory_usage_bytes", "Memory in use, including the page cache.")
+	MemoryOOMKills   = metrics.MustCounterSample("cgroup_memory_oom_kills_total", "Number of processes killed by the out-of-memory killer.")
+)
+
+// DefaultRoot is the common mount point of the control group filesystem.
+const DefaultRoot = "/sys/fs/cgroup"
+
+// Capture updates the samples from the control group of the process, as
+// listed in /proc/self/cgroup, under DefaultRoot. Processes with cgroup v1
+// read the root of each controller instead, which is their own group only
+// with a private cgroup namespace, as containers commonly have. Entries
+// absent from the filesystem are not considered an error. Their samples
+// remain unchanged.
+func Capture() error {
+	return CaptureRoot(groupRoot(DefaultRoot, "/proc/self/cgroup"))
+}
+
+// GroupRoot returns the directory of the unified hierarchy (cgroup v2) entry
+// in the process listing, relative to root. Root is returned as is without a
+// cgroup v2 mount or without a valid entry.
+func groupRoot(root, procFile string) string {
+	if Version(root) != 2 {
+		return root
+	}
+	text, err := os.ReadFile(procFile)
+	if err != nil {
+		return root
+	}
+	for _, line := range strings.Split(string(text), "\n") {
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		dir := filepath.Join(root, filepath.Clean("/"+line[len("0::"):]))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		break
+	}
+	return root
+}
+
+// CaptureRoot updates the samples from a control group filesystem mounted at
+// root. Entries absent from the filesystem are not considered an error. Their
+// samples remain unchanged.
+func CaptureRoot(root string) error {
+	switch Version(root) {
+	case 1:
+		return captureV1(root)
+	case 2:
+		return captureV2(root)
+	default:
+		return fmt.Errorf("cgroupstat: no control group hierarchy at %q", root)
+	}
+}
+
+// CaptureEvery updates the samples with an interval, starting now. Errors are
+// ignored, i.e., samples keep their last capture (if any) on failure.
+// The routine terminates with a send or close on cancel.
+func CaptureEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		Capture()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				Capture()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Version returns the control group version mounted at root, with zero for
+// none. The unified hierarchy (cgroup v2) has a cgroup.controllers file at
+// its root, while cgroup v1 has a directory per controller.
+func Version(root string) int {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if info, err := os.Stat(filepath.Join(root, "memory")); err == nil && info.IsDir() {
+		return 1
+	}
+	if info, err := os.Stat(filepath.Join(root, "cpu")); err == nil && info.IsDir() {
+		return 1
+	}
+	return 0
+}
+
+func captureV2(root string) error {
+	timestamp := time.Now()
+
+	if fields, err := readFields(filepath.Join(root, "cpu.max")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else if len(fields) != 2 {
+		return errors.New("cgroupstat: malformed cpu.max")
+	} else {
+		period, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cgroupstat: malformed cpu.max period: %w", err)
+		}
+		if fields[0] == "max" {
+			CPULimit.Set(math.Inf(1), timestamp)
+		} else {
+			quota, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("cgroupstat: malformed cpu.max quota: %w", err)
+			}
+			CPULimit.Set(float64(quota)/float64(period), timestamp)
+		}
+	}
+
+	if stat, err := readKeyed(filepath.Join(root, "cpu.stat")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		setIfPresent(CPUUsage, stat, "usage_usec", 1e6, timestamp)
+		setIfPresent(CPUPeriods, stat, "nr_periods", 1, timestamp)
+		setIfPresent(CPUThrottled, stat, "nr_throttled", 1, timestamp)
+		setIfPresent(CPUThrottledTime, stat, "throttled_usec", 1e6, timestamp)
+	}
+
+	if err := captureValue(MemoryLimit, filepath.Join(root, "memory.max"), timestamp); err != nil {
+		return err
+	}
+	if err := captureValue(MemoryUsage, filepath.Join(root, "memory.current"), timestamp); err != nil {
+		return err
+	}
+
+	if events, err := readKeyed(filepath.Join(root, "memory.events")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		setIfPresent(MemoryOOMKills, events, "oom_kill", 1, timestamp)
+	}
+
+	return nil
+}
+
+func captureV1(root string) error {
+	timestamp := time.Now()
+
+	quotaFields, err := readFields(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	periodFields, err := readFields(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(quotaFields) == 1 && len(periodFields) == 1 {
+		quota, err := strconv.ParseInt(quotaFields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cgroupstat: malformed cpu.cfs_quota_us: %w", err)
+		}
+		period, err := strconv.ParseUint(periodFields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cgroupstat: malformed cpu.cfs_period_us: %w", err)
+		}
+		if quota < 0 {
+			CPULimit.Set(math.Inf(1), timestamp)
+		} else {
+			CPULimit.Set(float64(quota)/float64(period), timestamp)
+		}
+	}
+
+	if stat, err := readKeyed(filepath.Join(root, "cpu", "cpu.stat")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		setIfPresent(CPUPeriods, stat, "nr_periods", 1, timestamp)
+		setIfPresent(CPUThrottled, stat, "nr_throttled", 1, timestamp)
+		setIfPresent(CPUThrottledTime, stat, "throttled_time", 1e9, timestamp)
+	}
+
+	if fields, err := readFields(filepath.Join(root, "cpuacct", "cpuacct.usage")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else if len(fields) == 1 {
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cgroupstat: malformed cpuacct.usage: %w", err)
+		}
+		CPUUsage.Set(float64(n)/1e9, timestamp)
+	}
+
+	if err := captureValue(MemoryLimit, filepath.Join(root, "memory", "memory.limit_in_bytes"), timestamp); err != nil {
+		return err
+	}
+	if err := captureValue(MemoryUsage, filepath.Join(root, "memory", "memory.usage_in_bytes"), timestamp); err != nil {
+		return err
+	}
+
+	if control, err := readKeyed(filepath.Join(root, "memory", "memory.oom_control")); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		setIfPresent(MemoryOOMKills, control, "oom_kill", 1, timestamp)
+	}
+
+	return nil
+}
+
+// CaptureValue sets the single value of a file, with "max" as infinity.
+func captureValue(s *metrics.Sample, path string, timestamp time.Time) error {
+	fields, err := readFields(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if len(fields) != 1 {
+		return fmt.Errorf("cgroupstat: got %d fields in %s, want 1", len(fields), filepath.Base(path))
+	}
+	if fields[0] == "max" {
+		s.Set(math.Inf(1), timestamp)
+		return nil
+	}
+	n, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("cgroupstat: malformed %s: %w", filepath.Base(path), err)
+	}
+	s.Set(float64(n), timestamp)
+	return nil
+}
+
+func setIfPresent(s *metrics.Sample, values map[string]uint64, key string, perUnit float64, timestamp time.Time) {
+	if n, ok := values[key]; ok {
+		s.Set(float64(n)/perUnit, timestamp)
+	}
+}
+
+// ReadFields returns the whitespace separated content of a file.
+func readFields(path string) ([]string, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(text)), nil
+}
+
+// ReadKeyed parses a file with a key–value pair per line.
+func readKeyed(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cgroupstat: malformed %s in %s: %w", key, filepath.Base(path), err)
+		}
+		values[key] = n
+	}
+	return values, scanner.Err()
+}
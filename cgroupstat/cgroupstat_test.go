@@ -0,0 +1,103 @@
+package cgroupstat
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+type golden struct {
+	s    *metrics.Sample
+	want float64
+}
+
+func verify(t *testing.T, goldens []golden) {
+	t.Helper()
+	for _, gold := range goldens {
+		if got, _ := gold.s.Get(); got != gold.want {
+			t.Errorf("%s got %g, want %g", gold.s.Name(), got, gold.want)
+		}
+	}
+}
+
+func TestV2(t *testing.T) {
+	if got := Version("testdata/v2"); got != 2 {
+		t.Fatalf("got version %d, want 2", got)
+	}
+	if err := CaptureRoot("testdata/v2"); err != nil {
+		t.Fatal(err)
+	}
+	verify(t, []golden{
+		{CPULimit, 1.5},
+		{CPUUsage, 2.5},
+		{CPUPeriods, 120},
+		{CPUThrottled, 7},
+		{CPUThrottledTime, 0.35},
+		{MemoryLimit, 536870912},
+		{MemoryUsage, 104857600},
+		{MemoryOOMKills, 2},
+	})
+}
+
+func TestV1(t *testing.T) {
+	if got := Version("testdata/v1"); got != 1 {
+		t.Fatalf("got version %d, want 1", got)
+	}
+	if err := CaptureRoot("testdata/v1"); err != nil {
+		t.Fatal(err)
+	}
+	verify(t, []golden{
+		{CPULimit, math.Inf(1)},
+		{CPUUsage, 7.5},
+		{CPUPeriods, 40},
+		{CPUThrottled, 4},
+		{CPUThrottledTime, 2},
+		{MemoryLimit, 9223372036854771712},
+		{MemoryUsage, 52428800},
+		{MemoryOOMKills, 1},
+	})
+}
+
+func TestNone(t *testing.T) {
+	if got := Version(t.TempDir()); got != 0 {
+		t.Errorf("got version %d for empty directory, want 0", got)
+	}
+	if err := CaptureRoot(t.TempDir()); err == nil {
+		t.Error("no error for empty directory")
+	}
+}
+
+func TestGroupRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	group := filepath.Join(root, "system.slice", "app.service")
+	if err := os.MkdirAll(group, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	procFile := filepath.Join(t.TempDir(), "cgroup")
+	golden := []struct{ listing, want string }{
+		{"0::/system.slice/app.service\n", group},
+		{"4:memory:/docker/abc\n0::/system.slice/app.service\n", group},
+		{"0::/\n", root},
+		{"0::/absent.slice\n", root},
+		{"4:memory:/docker/abc\n", root},
+	}
+	for _, gold := range golden {
+		if err := os.WriteFile(procFile, []byte(gold.listing), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := groupRoot(root, procFile); got != gold.want {
+			t.Errorf("got %q for listing %q, want %q", got, gold.listing, gold.want)
+		}
+	}
+
+	if got := groupRoot("testdata/v1", procFile); got != "testdata/v1" {
+		t.Errorf("got %q for cgroup v1, want root as is", got)
+	}
+}
@@ -0,0 +1,370 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics/internal/bounds"
+)
+
+// ErrCheckpointCorrupt signals a checkpoint file which failed validation.
+var ErrCheckpointCorrupt = errors.New("metrics: checkpoint file corrupt")
+
+// Checkpoint file format (version 1), in big-endian byte order:
+//
+//	magic "MTCP" | version uint16 | entry count uint32 | entries … | CRC-32C uint32
+//
+// Each entry starts with a kind byte plus a name with a uint16 length. The
+// counter kind has a uint64 value. The histogram kind has a uint32 number of
+// bucket bounds, each bound as float64, each (non-cumulative) bucket count as
+// uint64, the total count as uint64, and the sum as float64.
+const (
+	checkpointMagic   = "MTCP"
+	checkpointVersion = 1
+
+	checkpointCounter   = 1
+	checkpointHistogram = 2
+)
+
+// Checkpoint persists counters and histograms in a file, such that their
+// values survive restarts. Registration through a Checkpoint restores the
+// state from the file, if any. Only counters and histograms without labels
+// are supported, with names of up to 65535 bytes. Multiple goroutines may
+// invoke methods on a Checkpoint simultaneously.
+type Checkpoint struct {
+	path string
+
+	mutex sync.Mutex
+	// in order of registration
+	counters   []*Counter
+	histograms []*Histogram
+	// pending restores
+	counterState   map[string]uint64
+	histogramState map[string]histogramState
+}
+
+type histogramState struct {
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// OpenCheckpoint loads the state from path. A file which does not exist yet
+// is not an error. Validation failure returns an error which matches
+// ErrCheckpointCorrupt with errors.Is, together with a Checkpoint without any
+// state, such that callers may opt to continue from zero.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		path:           path,
+		counterState:   make(map[string]uint64),
+		histogramState: make(map[string]histogramState),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cp, nil
+		}
+		return nil, err
+	}
+	if err := cp.decode(data); err != nil {
+		cp.counterState = make(map[string]uint64)
+		cp.histogramState = make(map[string]histogramState)
+		return cp, fmt.Errorf("%w: %s: %s", ErrCheckpointCorrupt, path, err)
+	}
+	return cp, nil
+}
+
+// MustCounter registers a new Counter on reg, like Register.MustCounter does,
+// with the value from the checkpoint file, if any. A nil reg defaults to the
+// default register. Registration panics when name exceeds 65535 bytes.
+func (cp *Checkpoint) MustCounter(reg *Register, name, help string) *Counter {
+	mustCheckpointName(name)
+	if reg == nil {
+		reg = std
+	}
+	c := reg.MustCounter(name, help)
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if v, ok := cp.counterState[name]; ok {
+		delete(cp.counterState, name)
+		c.Add(v)
+	}
+	cp.counters = append(cp.counters, c)
+	return c
+}
+
+// MustHistogram registers a new Histogram on reg, like Register.MustHistogram
+// does, with the countings from the checkpoint file, if any. Countings with
+// other bucket bounds than the ones in use are discarded. A nil reg defaults
+// to the default register. Registration panics when name exceeds 65535 bytes.
+func (cp *Checkpoint) MustHistogram(reg *Register, name, help string, buckets ...float64) *Histogram {
+	mustCheckpointName(name)
+	if reg == nil {
+		reg = std
+	}
+	h := reg.MustHistogram(name, help, buckets...)
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if state, ok := cp.histogramState[name]; ok {
+		delete(cp.histogramState, name)
+		if bounds.Equal(state.bounds, h.BucketBounds) {
+			h.addState(state.buckets, state.count, state.sum)
+		}
+	}
+	cp.histograms = append(cp.histograms, h)
+	return h
+}
+
+// MustCheckpointName panics when name does not fit the uint16 length.
+func mustCheckpointName(name string) {
+	if len(name) > math.MaxUint16 {
+		panic("metrics: name too long for checkpoint")
+	}
+}
+
+// Save writes the current state to the file atomically, i.e., a temporary
+// file is written and synced before it is renamed to the destination.
+func (cp *Checkpoint) Save() error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	data := cp.encode()
+
+	dir, base := filepath.Split(cp.path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), cp.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// persist rename; not supported on all platforms
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// SaveEvery writes the current state with an interval. Errors are ignored.
+// The routine terminates with a send or close on cancel, after a final save.
+func (cp *Checkpoint) SaveEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				cp.Save()
+
+			case <-ch:
+				ticker.Stop()
+				cp.Save()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Encode serialises the registered metrics, plus any pending restores, such
+// that state is retained for metrics which did not register (yet).
+func (cp *Checkpoint) encode() []byte {
+	buf := append(make([]byte, 0, 512), checkpointMagic...)
+	buf = binary.BigEndian.AppendUint16(buf, checkpointVersion)
+	entryCount := len(cp.counters) + len(cp.histograms) + len(cp.counterState) + len(cp.histogramState)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(entryCount))
+
+	for _, c := range cp.counters {
+		buf = appendCheckpointCounter(buf, c.Name(), c.Get())
+	}
+	for _, name := range sortedKeys(cp.counterState) {
+		buf = appendCheckpointCounter(buf, name, cp.counterState[name])
+	}
+	for _, h := range cp.histograms {
+		buckets, count, sum := h.Get(make([]uint64, 0, len(h.BucketBounds)))
+		buf = appendCheckpointHistogram(buf, h.Name(), histogramState{h.BucketBounds, buckets, count, sum})
+	}
+	for _, name := range sortedKeys(cp.histogramState) {
+		buf = appendCheckpointHistogram(buf, name, cp.histogramState[name])
+	}
+
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crc32.MakeTable(crc32.Castagnoli)))
+}
+
+func appendCheckpointCounter(buf []byte, name string, value uint64) []byte {
+	buf = append(buf, checkpointCounter)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+	return binary.BigEndian.AppendUint64(buf, value)
+}
+
+func appendCheckpointHistogram(buf []byte, name string, state histogramState) []byte {
+	buf = append(buf, checkpointHistogram)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(state.bounds)))
+	for _, f := range state.bounds {
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+	}
+	for _, n := range state.buckets {
+		buf = binary.BigEndian.AppendUint64(buf, n)
+	}
+	buf = binary.BigEndian.AppendUint64(buf, state.count)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(state.sum))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (cp *Checkpoint) decode(data []byte) error {
+	if len(data) < len(checkpointMagic)+2+4+4 || string(data[:len(checkpointMagic)]) != checkpointMagic {
+		return errors.New("no checkpoint header")
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli)) != sum {
+		return errors.New("checksum mismatch")
+	}
+	if v := binary.BigEndian.Uint16(body[4:]); v != checkpointVersion {
+		return fmt.Errorf("unsupported version %d", v)
+	}
+	n := binary.BigEndian.Uint32(body[6:])
+	r := checkpointReader{buf: body[10:]}
+
+	for i := uint32(0); i < n; i++ {
+		kind := r.byte()
+		name := string(r.bytes(int(r.uint16())))
+		switch kind {
+		case checkpointCounter:
+			cp.counterState[name] = r.uint64()
+		case checkpointHistogram:
+			boundCount := int(r.uint32())
+			if boundCount > len(r.buf)/16 {
+				return errors.New("histogram size exceeds file")
+			}
+			state := histogramState{
+				bounds:  make([]float64, boundCount),
+				buckets: make([]uint64, boundCount),
+			}
+			for j := range state.bounds {
+				state.bounds[j] = math.Float64frombits(r.uint64())
+			}
+			for j := range state.buckets {
+				state.buckets[j] = r.uint64()
+			}
+			state.count = r.uint64()
+			state.sum = math.Float64frombits(r.uint64())
+			cp.histogramState[name] = state
+		default:
+			return fmt.Errorf("unknown entry kind %d", kind)
+		}
+		if r.short {
+			return errors.New("truncated entry")
+		}
+	}
+	if len(r.buf) != 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
+
+// CheckpointReader flags reads beyond the end of the buffer as short.
+type checkpointReader struct {
+	buf   []byte
+	short bool
+}
+
+func (r *checkpointReader) bytes(n int) []byte {
+	if n > len(r.buf) {
+		r.short = true
+		r.buf = nil
+		return nil
+	}
+	p := r.buf[:n]
+	r.buf = r.buf[n:]
+	return p
+}
+
+func (r *checkpointReader) byte() byte {
+	if p := r.bytes(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *checkpointReader) uint16() uint16 {
+	if p := r.bytes(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *checkpointReader) uint32() uint32 {
+	if p := r.bytes(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *checkpointReader) uint64() uint64 {
+	if p := r.bytes(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+// AddState applies countings as an atomic operation. Buckets are
+// non-cumulative, with the positive infinity one omitted.
+func (h *Histogram) addState(buckets []uint64, count uint64, sum float64) {
+	if count == 0 {
+		return
+	}
+
+	hotIndex := h.beginWrite(count)
+
+	// update hot buckets
+	hotBuckets := h.hotAndColdBuckets[hotIndex]
+	for i, n := range buckets {
+		if i*16 < len(hotBuckets) {
+			hotBuckets[i*16].Add(n)
+		}
+	}
+
+	h.endWrite(hotIndex, count, sum)
+}
@@ -0,0 +1,145 @@
+package metrics_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestCheckpointRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.checkpoint")
+
+	cp, err := metrics.OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal("open without file:", err)
+	}
+	reg := metrics.NewRegister()
+	cp.MustCounter(reg, "requests_total", "").Add(42)
+	h := cp.MustHistogram(reg, "latency_seconds", "", 0.1, 1)
+	h.Add(0.05)
+	h.Add(0.5)
+	h.Add(5)
+	cp.MustHistogram(reg, "size_bytes", "", 10).Add(7)
+	if err := cp.Save(); err != nil {
+		t.Fatal("save error:", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in checkpoint directory, want 1", len(entries))
+	}
+
+	// restart
+	cp, err = metrics.OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal("open error:", err)
+	}
+	reg = metrics.NewRegister()
+	c := cp.MustCounter(reg, "requests_total", "")
+	if got := c.Get(); got != 42 {
+		t.Errorf("got counter value %d, want 42", got)
+	}
+	h = cp.MustHistogram(reg, "latency_seconds", "", 0.1, 1)
+	h.Add(0.05)
+	buckets, count, sum := h.Get(nil)
+	if want := []uint64{2, 1}; !reflect.DeepEqual(buckets, want) {
+		t.Errorf("got histogram buckets %d, want %d", buckets, want)
+	}
+	if count != 4 || sum != 5.6 {
+		t.Errorf("got histogram count %d and sum %g, want 4 and 5.6", count, sum)
+	}
+	// bounds changed
+	h = cp.MustHistogram(reg, "size_bytes", "", 100)
+	if _, count, _ := h.Get(nil); count != 0 {
+		t.Errorf("got histogram count %d with other bucket bounds, want 0", count)
+	}
+}
+
+func TestCheckpointRetainsUnregistered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.checkpoint")
+
+	cp, _ := metrics.OpenCheckpoint(path)
+	cp.MustCounter(metrics.NewRegister(), "a_total", "").Add(1)
+	if err := cp.Save(); err != nil {
+		t.Fatal("save error:", err)
+	}
+
+	// save without registration
+	cp, _ = metrics.OpenCheckpoint(path)
+	if err := cp.Save(); err != nil {
+		t.Fatal("save error:", err)
+	}
+
+	cp, _ = metrics.OpenCheckpoint(path)
+	if got := cp.MustCounter(metrics.NewRegister(), "a_total", "").Get(); got != 1 {
+		t.Errorf("got counter value %d, want 1", got)
+	}
+}
+
+func TestCheckpointCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.checkpoint")
+
+	cp, _ := metrics.OpenCheckpoint(path)
+	cp.MustCounter(metrics.NewRegister(), "a_total", "").Add(99)
+	if err := cp.Save(); err != nil {
+		t.Fatal("save error:", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range data {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0x10
+		if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		cp, err := metrics.OpenCheckpoint(path)
+		if !errors.Is(err, metrics.ErrCheckpointCorrupt) {
+			t.Fatalf("byte %d flipped got error %v, want ErrCheckpointCorrupt", i, err)
+		}
+		if got := cp.MustCounter(metrics.NewRegister(), "a_total", "").Get(); got != 0 {
+			t.Fatalf("byte %d flipped got counter value %d, want 0", i, got)
+		}
+	}
+
+	if err := os.WriteFile(path, data[:len(data)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := metrics.OpenCheckpoint(path); !errors.Is(err, metrics.ErrCheckpointCorrupt) {
+		t.Errorf("truncated file got error %v, want ErrCheckpointCorrupt", err)
+	}
+}
+
+func TestCheckpointNameLimit(t *testing.T) {
+	cp, _ := metrics.OpenCheckpoint(filepath.Join(t.TempDir(), "metrics.checkpoint"))
+	reg := metrics.NewRegister()
+	name := strings.Repeat("a", 1<<16)
+	for _, f := range []func(){
+		func() { cp.MustCounter(reg, name, "") },
+		func() { cp.MustHistogram(reg, name, "", 1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic for name of 65536 bytes")
+				}
+			}()
+			f()
+		}()
+	}
+
+	if got := reg.Snapshot(); len(got) != 0 {
+		t.Errorf("got %d families registered, want none", len(got))
+	}
+}
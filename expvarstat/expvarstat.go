@@ -0,0 +1,160 @@
+// Package expvarstat bridges between metrics and the expvar package, in both
+// directions.
+package expvarstat
+
+import (
+	"bytes"
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Var exposes a Register as an expvar.Var, in the format of WriteJSON.
+type Var struct {
+	reg *metrics.Register
+}
+
+// NewVar returns a new Var for reg. A nil reg defaults to the default register
+// of the metrics package.
+func NewVar(reg *metrics.Register) *Var {
+	return &Var{reg: reg}
+}
+
+// String implements the expvar.Var interface.
+func (v *Var) String() string {
+	var buf bytes.Buffer
+	if v.reg == nil {
+		metrics.WriteJSON(&buf)
+	} else {
+		v.reg.WriteJSON(&buf)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// Publish exposes reg under name with expvar. A nil reg defaults to the default
+// register of the metrics package. Publish panics when name is in use already,
+// just like expvar.Publish does.
+func Publish(name string, reg *metrics.Register) {
+	expvar.Publish(name, NewVar(reg))
+}
+
+// Collector imports expvar.Int, expvar.Float and expvar.Map variables as
+// gauges. Map entries with an expvar.Int or an expvar.Float value become a
+// series with the map key as the "key" label. Any other variables, such as
+// expvar.Func, expvar.String and Var, are ignored. Multiple goroutines may
+// invoke methods on a Collector simultaneously.
+type Collector struct {
+	mutex sync.Mutex
+
+	// Vars are in order of expvar name.
+	vars []importVar
+}
+
+type importVar struct {
+	v      expvar.Var
+	sample *metrics.Sample                  // nil for maps
+	keyed  func(key string) *metrics.Sample // nil for scalars
+}
+
+// New registers each supported expvar variable on reg, with prefix plus the
+// sanitised variable name as the metric name, e.g., "expvar_" + "requests".
+// Variables published after New are not included. Registration panics on name
+// conflicts, and so do multiple variables with the same sanitised name.
+func New(reg *metrics.Register, prefix string) *Collector {
+	c := new(Collector)
+	expvar.Do(func(kv expvar.KeyValue) {
+		name := SanitizeName(prefix + kv.Key)
+		help := "Imported from expvar " + kv.Key + "."
+
+		switch kv.Value.(type) {
+		case *expvar.Int, *expvar.Float:
+			c.vars = append(c.vars, importVar{v: kv.Value, sample: reg.MustRealSample(name, help)})
+		case *expvar.Map:
+			c.vars = append(c.vars, importVar{v: kv.Value, keyed: reg.Must1LabelRealSample(name, "key")})
+			reg.MustHelp(name, help)
+		}
+	})
+	return c
+}
+
+// SanitizeName returns s with each character which is not permitted in a
+// metric name replaced by an underscore. A leading digit gets an underscore
+// prepended.
+func SanitizeName(s string) string {
+	if s == "" {
+		return "_"
+	}
+
+	var buf strings.Builder
+	if s[0] >= '0' && s[0] <= '9' {
+		buf.WriteByte('_')
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == ':' {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	return buf.String()
+}
+
+// Capture updates the metrics.
+func (c *Collector) Capture() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timestamp := time.Now()
+	for _, iv := range c.vars {
+		if iv.sample != nil {
+			if f, ok := value(iv.v); ok {
+				iv.sample.Set(f, timestamp)
+			}
+			continue
+		}
+
+		iv.v.(*expvar.Map).Do(func(kv expvar.KeyValue) {
+			if f, ok := value(kv.Value); ok {
+				iv.keyed(kv.Key).Set(f, timestamp)
+			}
+		})
+	}
+}
+
+func value(v expvar.Var) (float64, bool) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		return float64(v.Value()), true
+	case *expvar.Float:
+		return v.Value(), true
+	}
+	return 0, false
+}
+
+// CaptureEvery updates the metrics with an interval, starting now.
+// The routine terminates with a send or close on cancel.
+func (c *Collector) CaptureEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		c.Capture()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				c.Capture()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,92 @@
+package expvarstat
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestPublish(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.MustCounter("jobs_total", "").Add(2)
+	Publish("test_register", reg)
+
+	v := expvar.Get("test_register")
+	if v == nil {
+		t.Fatal("register not published")
+	}
+	var doc struct {
+		Families []struct {
+			Name   string
+			Series []struct{ Value float64 }
+		}
+	}
+	if err := json.Unmarshal([]byte(v.String()), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %s", v.String(), err)
+	}
+	if len(doc.Families) != 1 || doc.Families[0].Name != "jobs_total" || doc.Families[0].Series[0].Value != 2 {
+		t.Errorf("got %+v, want jobs_total 2", doc)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	expvar.NewInt("test.hits-count").Add(7)
+	expvar.NewFloat("test_load").Set(0.25)
+	m := expvar.NewMap("test_by_path")
+	m.Add("/a", 1)
+	m.AddFloat("/b", 1.5)
+	m.Set("other", new(expvar.String))
+	expvar.NewString("test_version").Set("v1")
+
+	reg := metrics.NewRegister()
+	c := New(reg, "expvar_")
+	c.Capture()
+
+	metrics.SkipTimestamp = true
+	var buf strings.Builder
+	reg.WriteTo(&buf)
+	got := buf.String()
+	for _, want := range []string{
+		"\nexpvar_test_hits_count 7\n",
+		"\nexpvar_test_load 0.25\n",
+		"\nexpvar_test_by_path{key=\"/a\"} 1\n",
+		"\nexpvar_test_by_path{key=\"/b\"} 1.5\n",
+		"# HELP expvar_test_by_path Imported from expvar test_by_path.\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"version", "cmdline", "memstats", "other"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unsupported variable %q in:\n%s", unwanted, got)
+		}
+	}
+
+	// updates
+	m.Add("/a", 2)
+	c.Capture()
+	buf.Reset()
+	reg.WriteTo(&buf)
+	if want := "\nexpvar_test_by_path{key=\"/a\"} 3\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("missing %q after update in:\n%s", want, buf.String())
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	golden := []struct{ in, want string }{
+		{"", "_"},
+		{"requests", "requests"},
+		{"http.requests-total", "http_requests_total"},
+		{"9lives", "_9lives"},
+		{"a:b/c π", "a:b_c___"},
+	}
+	for _, gold := range golden {
+		if got := SanitizeName(gold.in); got != gold.want {
+			t.Errorf("SanitizeName(%q) got %q, want %q", gold.in, got, gold.want)
+		}
+	}
+}
@@ -42,10 +42,7 @@ var BuildInfo = metrics.Must3LabelInteger("go_build_info", "path", "version", "c
 var (
 	NumGoroutine = metrics.MustRealSample("go_goroutines", "Number of goroutines that currently exist.")
 	ThreadCreate = metrics.MustRealSample("go_threads", "Number of OS threads created.")
-
-	// BUG(pascaldekloe): go_gc_duration_seconds not implemented
-
-	// GCPause = metrics.MustSummarySample("go_gc_duration_seconds", "A summary of the GC invocation durations.")
+	GCPause      = metrics.MustSummarySample("go_gc_duration_seconds", "A summary of the GC invocation durations.", 0, .25, .5, .75, 1)
 )
 
 // Memory Allocation Samples
@@ -82,9 +79,18 @@ func Capture() {
 	recordCount, _ := runtime.ThreadCreateProfile(nil)
 	ThreadCreate.Set(float64(recordCount), time.Now())
 
+	gcStats := debug.GCStats{PauseQuantiles: make([]time.Duration, len(GCPause.Quantiles))}
+	debug.ReadGCStats(&gcStats)
+	timestamp := time.Now()
+	pauses := make([]float64, len(gcStats.PauseQuantiles))
+	for i, d := range gcStats.PauseQuantiles {
+		pauses[i] = d.Seconds()
+	}
+	GCPause.Set(pauses, uint64(gcStats.NumGC), gcStats.PauseTotal.Seconds(), timestamp)
+
 	stats := new(runtime.MemStats)
 	runtime.ReadMemStats(stats)
-	timestamp := time.Now()
+	timestamp = time.Now()
 
 	Alloc.Set(float64(stats.Alloc), timestamp)
 	TotalAlloc.Set(float64(stats.TotalAlloc), timestamp)
@@ -33,9 +33,6 @@ func TestCapture(t *testing.T) {
 		if !strings.HasPrefix(line, "# TYPE ") {
 			continue
 		}
-		if line == "# TYPE go_gc_duration_seconds summary\n" {
-			continue
-		}
 		if !strings.Contains(got, line) {
 			t.Errorf("missing %q", line)
 		}
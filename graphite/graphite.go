@@ -0,0 +1,352 @@
+// Package graphite provides metric exports to Graphite (Carbon), with either
+// the plaintext or the pickle protocol over TCP.
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+	"github.com/pascaldekloe/metrics/internal/flatten"
+)
+
+// Flatten converts a metric name with labels into a Graphite path.
+type Flatten func(name string, labels map[string]string) string
+
+// FlattenValues appends each label value as a path node, in order of label
+// name, e.g., "http_requests_total.GET.200".
+func FlattenValues(name string, labels map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString(sanitizeNode(name))
+	for _, label := range flatten.SortedLabelNames(labels) {
+		buf.WriteByte('.')
+		buf.WriteString(sanitizeNode(labels[label]))
+	}
+	return buf.String()
+}
+
+// FlattenPairs appends each label name and value as a path node pair, in
+// order of label name, e.g., "http_requests_total.code.200.method.GET".
+func FlattenPairs(name string, labels map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString(sanitizeNode(name))
+	for _, label := range flatten.SortedLabelNames(labels) {
+		buf.WriteByte('.')
+		buf.WriteString(sanitizeNode(label))
+		buf.WriteByte('.')
+		buf.WriteString(sanitizeNode(labels[label]))
+	}
+	return buf.String()
+}
+
+// FlattenTags appends labels as tags, which requires Graphite 1.1 or later,
+// e.g., "http_requests_total;code=200;method=GET".
+func FlattenTags(name string, labels map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString(sanitizeNode(name))
+	for _, label := range flatten.SortedLabelNames(labels) {
+		v := labels[label]
+		if v == "" {
+			continue // not permitted
+		}
+		buf.WriteByte(';')
+		buf.WriteString(sanitizeTag(label))
+		buf.WriteByte('=')
+		buf.WriteString(sanitizeTag(v))
+	}
+	return buf.String()
+}
+
+// SanitizeNode replaces path separators, whitespace and control characters.
+func sanitizeNode(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '.' || r == '/' || r == ';' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// SanitizeTag replaces separators, whitespace and control characters.
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == ';' || r == '=' || r == '~' || r == '!' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Backoff limits for reconnects.
+const (
+	MinBackoff = time.Second
+	MaxBackoff = time.Minute
+)
+
+// PickleBatchSize is the maximum number of points per pickle message.
+const PickleBatchSize = 500
+
+// Exporter sends the content of a Register to a Carbon receiver. Histograms
+// and summaries are converted like they are in the Prometheus text format,
+// i.e., with "_bucket", "_count" and "_sum" suffixes, plus the "le" label for
+// buckets and the "quantile" label for summaries. Multiple goroutines may
+// invoke methods on an Exporter simultaneously.
+type Exporter struct {
+	// Prefix is prepended to each path, e.g., "myapp.".
+	Prefix string
+
+	// Flatten converts labels into the path.
+	// The nil value defaults to FlattenValues.
+	Flatten Flatten
+
+	// Pickle selects the pickle protocol, which is usually served on
+	// port 2004, instead of the plaintext protocol on port 2003.
+	Pickle bool
+
+	// Timeout applies to both connect and write.
+	// The zero value defaults to 10 seconds.
+	Timeout time.Duration
+
+	reg  *metrics.Register
+	addr string
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+	lastErr error
+}
+
+// NewExporter returns a new Exporter which sends the content of reg to the
+// TCP address addr, e.g., "graphite.example.com:2003". A nil reg defaults to
+// the default register of the metrics package.
+func NewExporter(reg *metrics.Register, addr string) *Exporter {
+	return &Exporter{reg: reg, addr: addr}
+}
+
+// Point is a Graphite measurement.
+type point struct {
+	path      string
+	value     float64
+	timestamp int64 // Unix seconds
+}
+
+// Export sends a snapshot. Connection failures cause a reconnect, with an
+// exponential backoff from MinBackoff up to MaxBackoff. An export within the
+// backoff period fails without any attempt.
+func (e *Exporter) Export() error {
+	var families []metrics.Family
+	if e.reg == nil {
+		families = metrics.Snapshot()
+	} else {
+		families = e.reg.Snapshot()
+	}
+	points := e.points(families, time.Now())
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.conn == nil && !e.retryAt.IsZero() && time.Now().Before(e.retryAt) {
+		return fmt.Errorf("graphite: reconnect delayed until %s: %w", e.retryAt.Format(time.RFC3339), e.lastErr)
+	}
+
+	err := e.send(points)
+	if err != nil && e.conn == nil && e.backoff == 0 {
+		// stale connection; retry once
+		err = e.send(points)
+	}
+	return err
+}
+
+// ExportEvery sends a snapshot with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel, which
+// also closes the connection.
+func (e *Exporter) ExportEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		e.Export()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				e.Export()
+
+			case <-ch:
+				ticker.Stop()
+				e.Close()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Close terminates the connection, if any.
+func (e *Exporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// Send writes points on the connection, which is established when needed.
+// Failure resets the connection, and any dial error sets the backoff.
+func (e *Exporter) send(points []point) error {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	if e.conn == nil {
+		conn, err := net.DialTimeout("tcp", e.addr, timeout)
+		if err != nil {
+			if e.backoff == 0 {
+				e.backoff = MinBackoff
+			} else if e.backoff *= 2; e.backoff > MaxBackoff {
+				e.backoff = MaxBackoff
+			}
+			e.retryAt = time.Now().Add(e.backoff)
+			e.lastErr = err
+			return fmt.Errorf("graphite: %w", err)
+		}
+		e.conn = conn
+		e.backoff = 0
+		e.retryAt = time.Time{}
+		e.lastErr = nil
+	}
+
+	e.conn.SetWriteDeadline(time.Now().Add(timeout))
+	w := bufio.NewWriter(e.conn)
+	if e.Pickle {
+		for len(points) != 0 {
+			n := len(points)
+			if n > PickleBatchSize {
+				n = PickleBatchSize
+			}
+			w.Write(appendPickle(nil, points[:n]))
+			points = points[n:]
+		}
+	} else {
+		var line []byte
+		for _, p := range points {
+			line = appendPlaintext(line[:0], p)
+			w.Write(line)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		e.conn.Close()
+		e.conn = nil
+		return fmt.Errorf("graphite: %w", err)
+	}
+	return nil
+}
+
+// Points converts families into Graphite measurements. Samples keep their
+// capture timestamp. All others get the timestamp of now.
+func (e *Exporter) points(families []metrics.Family, now time.Time) []point {
+	toPath := e.Flatten
+	if toPath == nil {
+		toPath = FlattenValues
+	}
+
+	var points []point
+	var samples []flatten.Sample
+	for _, f := range families {
+		for i := range f.Series {
+			s := &f.Series[i]
+			timestamp := now.Unix()
+			if s.Timestamp != 0 {
+				timestamp = int64(s.Timestamp / 1000)
+			}
+
+			samples = flatten.AppendSamples(samples[:0], f.Type, s)
+			for _, sample := range samples {
+				points = append(points, point{
+					path:      e.Prefix + toPath(f.Name+sample.Suffix, sample.Labels(s.Labels)),
+					value:     sample.Value,
+					timestamp: timestamp,
+				})
+			}
+		}
+	}
+	return points
+}
+
+// AppendPlaintext appends a line in the plaintext protocol.
+func appendPlaintext(buf []byte, p point) []byte {
+	buf = append(buf, p.path...)
+	buf = append(buf, ' ')
+	buf = appendValue(buf, p.value)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.timestamp, 10)
+	return append(buf, '\n')
+}
+
+func appendValue(buf []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(buf, "nan"...)
+	case math.IsInf(f, 1):
+		return append(buf, "inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-inf"...)
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, 64)
+}
+
+// Pickle opcodes (protocol 2)
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleBinInt     = 'J'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// AppendPickle appends a message in the pickle protocol, which is a length
+// header followed by a serialised list of (path, (timestamp, value)) tuples.
+func appendPickle(buf []byte, points []point) []byte {
+	offset := len(buf)
+	buf = append(buf, 0, 0, 0, 0) // length placeholder
+
+	buf = append(buf, pickleProto, 2, pickleEmptyList, pickleMark)
+	for _, p := range points {
+		buf = append(buf, pickleBinUnicode)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.path)))
+		buf = append(buf, p.path...)
+
+		if p.timestamp >= math.MinInt32 && p.timestamp <= math.MaxInt32 {
+			buf = append(buf, pickleBinInt)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(p.timestamp)))
+		} else {
+			buf = append(buf, pickleBinFloat)
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(float64(p.timestamp)))
+		}
+		buf = append(buf, pickleBinFloat)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(p.value))
+
+		buf = append(buf, pickleTuple2, pickleTuple2)
+	}
+	buf = append(buf, pickleAppends, pickleStop)
+
+	binary.BigEndian.PutUint32(buf[offset:], uint32(len(buf)-offset-4))
+	return buf
+}
@@ -0,0 +1,221 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Serve returns a local TCP listener, which passes each connection on the
+// channel.
+func serve(t *testing.T) (addr string, conns <-chan net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("TCP listener unavailable:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			ch <- conn
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func accept(t *testing.T, conns <-chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-conns:
+		return conn
+	case <-time.After(time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+func TestPlaintext(t *testing.T) {
+	addr, conns := serve(t)
+
+	reg := metrics.NewRegister()
+	reg.Must2LabelCounter("requests_total", "method", "code")("GET", "200").Add(2)
+	reg.MustRealSample("temperature", "").Set(21.5, time.Unix(1615130567, 389e6))
+	h := reg.MustHistogram("latency_seconds", "", 0.1)
+	h.Add(0.05)
+	h.Add(0.2)
+
+	exp := NewExporter(reg, addr)
+	exp.Prefix = "app."
+	exp.Flatten = FlattenPairs
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	defer exp.Close()
+
+	r := bufio.NewReader(accept(t, conns))
+	want := []string{
+		"app.requests_total.code.200.method.GET 2",
+		"app.temperature 21.5 1615130567",
+		"app.latency_seconds_bucket.le.0_1 1",
+		"app.latency_seconds_bucket.le.+Inf 2",
+		"app.latency_seconds_count 2",
+		"app.latency_seconds_sum 0.25",
+	}
+	for _, w := range want {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("read error:", err)
+		}
+		if !strings.HasPrefix(line, w+" ") && line != w+"\n" {
+			t.Errorf("got line %q, want %q", line, w)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	labels := map[string]string{"method": "GET", "path": "/a.b"}
+	golden := []struct {
+		f    Flatten
+		want string
+	}{
+		{FlattenValues, "hits.GET._a_b"},
+		{FlattenPairs, "hits.method.GET.path._a_b"},
+		{FlattenTags, "hits;method=GET;path=/a.b"},
+	}
+	for _, gold := range golden {
+		if got := gold.f("hits", labels); got != gold.want {
+			t.Errorf("got %q, want %q", got, gold.want)
+		}
+	}
+}
+
+func TestPickle(t *testing.T) {
+	addr, conns := serve(t)
+
+	reg := metrics.NewRegister()
+	reg.MustInteger("a", "").Set(-1)
+	reg.MustRealSample("b", "").Set(0.5, time.Unix(1615130567, 0))
+
+	exp := NewExporter(reg, addr)
+	exp.Pickle = true
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	defer exp.Close()
+
+	conn := accept(t, conns)
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		t.Fatal("header read error:", err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		t.Fatal("message read error:", err)
+	}
+
+	got, err := unpickle(msg)
+	if err != nil {
+		t.Fatal("unpickle error:", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %q, want 2 entries", got)
+	}
+	if !strings.HasPrefix(got[0], "a (") || !strings.HasSuffix(got[0], " -1)") {
+		t.Errorf("got entry %q, want a with value -1", got[0])
+	}
+	if want := "b (1615130567 0.5)"; got[1] != want {
+		t.Errorf("got entry %q, want %q", got[1], want)
+	}
+}
+
+// Unpickle decodes the opcodes of appendPickle only.
+func unpickle(msg []byte) ([]string, error) {
+	var stack []string
+	var list []string
+	for i := 0; i < len(msg); {
+		op := msg[i]
+		i++
+		switch op {
+		case pickleProto:
+			i++
+		case pickleEmptyList, pickleMark:
+			// single list only
+		case pickleBinUnicode:
+			n := int(binary.LittleEndian.Uint32(msg[i:]))
+			stack = append(stack, string(msg[i+4:i+4+n]))
+			i += 4 + n
+		case pickleBinInt:
+			stack = append(stack, fmt.Sprint(int32(binary.LittleEndian.Uint32(msg[i:]))))
+			i += 4
+		case pickleBinFloat:
+			stack = append(stack, fmt.Sprint(math.Float64frombits(binary.BigEndian.Uint64(msg[i:]))))
+			i += 8
+		case pickleTuple2:
+			a, b := stack[len(stack)-2], stack[len(stack)-1]
+			stack = append(stack[:len(stack)-2], fmt.Sprintf("(%s %s)", a, b))
+		case pickleAppends:
+			for _, s := range stack {
+				// tuple of path and (timestamp, value)
+				list = append(list, strings.TrimSuffix(strings.TrimPrefix(s, "("), ")"))
+			}
+			stack = stack[:0]
+		case pickleStop:
+			return list, nil
+		default:
+			return nil, fmt.Errorf("unknown opcode %#x at %d", op, i-1)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func TestReconnect(t *testing.T) {
+	// reserve a port without listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("TCP listener unavailable:", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	exp := NewExporter(metrics.NewRegister(), addr)
+	if err := exp.Export(); err == nil {
+		t.Fatal("export without listener got no error")
+	}
+	err = exp.Export()
+	if err == nil || !strings.Contains(err.Error(), "reconnect delayed") {
+		t.Errorf("export within backoff got error %v, want reconnect delayed", err)
+	}
+	if exp.backoff != MinBackoff {
+		t.Errorf("got backoff %s, want %s", exp.backoff, MinBackoff)
+	}
+
+	// expire backoff
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("port reuse unavailable:", err)
+	}
+	defer l.Close()
+	exp.retryAt = time.Now()
+	if err := exp.Export(); err != nil {
+		t.Fatal("export after backoff got error:", err)
+	}
+	defer exp.Close()
+	if exp.backoff != 0 {
+		t.Errorf("got backoff %s after connect, want reset", exp.backoff)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHistogramReadStall(t *testing.T) {
+	h := newHistogram("h", []float64{1})
+	h.Add(0.5)
+	// read with a start time, for reuse
+	if _, count, _, err := h.GetRecent(nil, time.Hour, 0); err != nil || count != 1 {
+		t.Fatalf("got count %d with error %v, want 1", count, err)
+	}
+
+	// write transaction which does not complete yet
+	hotIndex := h.countAndHotIndex.Add(1) >> 63
+	h.Add(2)
+
+	buckets, count, sum, err := h.GetRecent(nil, 0, 10*time.Millisecond)
+	if err != ErrHistogramStall {
+		t.Fatalf("got error %v, want ErrHistogramStall", err)
+	}
+	if len(buckets) != 1 || buckets[0] != 1 || count != 1 || sum != 0.5 {
+		t.Errorf("stalled read got buckets %d, count %d, sum %g; want last read", buckets, count, sum)
+	}
+	// pending switch must not block writes nor reuse of reads
+	h.Add(3)
+	if _, count, _, err := h.GetRecent(nil, time.Hour, 10*time.Millisecond); err != nil || count != 1 {
+		t.Errorf("got count %d with error %v, want last read without error", count, err)
+	}
+
+	// complete the write transaction
+	h.hotAndColdBuckets[hotIndex][0].Add(1)
+	h.hotAndColdCounts[hotIndex*16].Add(1)
+
+	buckets, count, sum = h.Get(nil)
+	if len(buckets) != 1 || buckets[0] != 2 || count != 4 || sum != 5.5 {
+		t.Errorf("got buckets %d, count %d, sum %g; want [2], 4, 5.5", buckets, count, sum)
+	}
+}
+
+func TestHistogramStallOmitted(t *testing.T) {
+	defer func(d time.Duration) { HistogramMaxWait = d }(HistogramMaxWait)
+	HistogramMaxWait = 10 * time.Millisecond
+
+	reg := NewRegister()
+	h := reg.MustHistogram("h", "stalls")
+	// write transaction which does not complete
+	h.countAndHotIndex.Add(1)
+	labeled := reg.Must1LabelHistogram("l", "x")
+	labeled("stalls").countAndHotIndex.Add(1)
+	labeled("ok").Add(1)
+
+	defer func(skip bool) { SkipTimestamp = skip }(SkipTimestamp)
+	SkipTimestamp = true
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	const want = `# Prometheus Samples
+
+# TYPE l histogram
+l_count{x="ok"} 1
+l{le="+Inf",x="ok"} 1
+l_sum{x="ok"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got text output:\n%s\nwant:\n%s", got, want)
+	}
+	for _, f := range reg.Snapshot() {
+		if f.Name == "h" && len(f.Series) != 0 || f.Name == "l" && len(f.Series) != 1 {
+			t.Errorf("got %s series %+v", f.Name, f.Series)
+		}
+	}
+}
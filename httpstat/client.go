@@ -0,0 +1,174 @@
+package httpstat
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Phase label values for the request phase histogram.
+const (
+	PhaseDNS       = "dns"        // name resolution
+	PhaseConnect   = "connect"    // dial until connected
+	PhaseTLS       = "tls"        // TLS handshake
+	PhaseFirstByte = "first_byte" // request start until response receival
+)
+
+// Client has metrics for outgoing requests. Multiple goroutines may invoke
+// methods on a Client simultaneously.
+type Client struct {
+	requests func(method, code string) *metrics.Counter
+	errors   func(method string) *metrics.Counter
+	duration *metrics.Histogram
+	dns      *metrics.Histogram
+	connect  *metrics.Histogram
+	tls      *metrics.Histogram
+	response *metrics.Histogram
+	inFlight *metrics.Integer
+}
+
+// NewClient registers the following metrics on reg, with prefix as the name
+// start, e.g., "http_client".
+//
+//	<prefix>_requests_total{method,code} counter
+//	<prefix>_request_errors_total{method} counter
+//	<prefix>_request_duration_seconds histogram
+//	<prefix>_request_phase_seconds{phase} histogram
+//	<prefix>_requests_in_flight gauge
+//
+// Registration panics on name conflicts.
+func NewClient(reg *metrics.Register, prefix string) *Client {
+	phase := reg.Must1LabelHistogram(prefix+"_request_phase_seconds", "phase", LatencyBuckets...)
+	c := &Client{
+		requests: reg.Must2LabelCounter(prefix+"_requests_total", "method", "code"),
+		errors:   reg.Must1LabelCounter(prefix+"_request_errors_total", "method"),
+		duration: reg.MustHistogram(prefix+"_request_duration_seconds", "Time from request start until response header receival.", LatencyBuckets...),
+		dns:      phase(PhaseDNS),
+		connect:  phase(PhaseConnect),
+		tls:      phase(PhaseTLS),
+		response: phase(PhaseFirstByte),
+		inFlight: reg.MustInteger(prefix+"_requests_in_flight", "Number of requests awaiting a response."),
+	}
+
+	reg.MustHelp(prefix+"_requests_total", "Number of responses received.")
+	reg.MustHelp(prefix+"_request_errors_total", "Number of requests without response.")
+	reg.MustHelp(prefix+"_request_phase_seconds", "Time spent per connection phase.")
+
+	return c
+}
+
+// RoundTripper returns next with instrumentation. A nil next defaults to
+// http.DefaultTransport. Requests count as in flight until the response
+// headers are received. Reuse of connections omits the DNS, connect and TLS
+// phases.
+func (c *Client) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t := clientTrace{Client: c, start: time.Now()}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			DNSStart:             t.dnsStart,
+			DNSDone:              t.dnsDone,
+			ConnectStart:         t.connectStart,
+			ConnectDone:          t.connectDone,
+			TLSHandshakeStart:    t.tlsHandshakeStart,
+			TLSHandshakeDone:     t.tlsHandshakeDone,
+			GotFirstResponseByte: t.gotFirstResponseByte,
+		}))
+
+		c.inFlight.Add(1)
+		resp, err := next.RoundTrip(req)
+		c.inFlight.Add(-1)
+
+		method := MethodLabel(req.Method)
+		if err != nil {
+			c.errors(method).Add(1)
+			return nil, err
+		}
+		c.duration.AddSince(t.start)
+		c.requests(method, strconv.Itoa(resp.StatusCode)).Add(1)
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ClientTrace tracks the phases of a single request. Hooks may be invoked
+// from other goroutines. Connects may even run in parallel, i.e., “Happy
+// Eyeballs”, in which case only the first successful one counts.
+type clientTrace struct {
+	*Client
+	start time.Time
+
+	sync.Mutex
+	dnsAt     time.Time
+	connectAt time.Time
+	connected bool
+	tlsAt     time.Time
+}
+
+func (t *clientTrace) dnsStart(httptrace.DNSStartInfo) {
+	t.Lock()
+	t.dnsAt = time.Now()
+	t.Unlock()
+}
+
+func (t *clientTrace) dnsDone(httptrace.DNSDoneInfo) {
+	t.Lock()
+	start := t.dnsAt
+	t.Unlock()
+	if !start.IsZero() {
+		t.dns.AddSince(start)
+	}
+}
+
+func (t *clientTrace) connectStart(network, addr string) {
+	t.Lock()
+	if t.connectAt.IsZero() {
+		t.connectAt = time.Now()
+	}
+	t.Unlock()
+}
+
+func (t *clientTrace) connectDone(network, addr string, err error) {
+	if err != nil {
+		return
+	}
+	t.Lock()
+	start, connected := t.connectAt, t.connected
+	t.connected = true
+	t.Unlock()
+	if !connected && !start.IsZero() {
+		t.connect.AddSince(start)
+	}
+}
+
+func (t *clientTrace) tlsHandshakeStart() {
+	t.Lock()
+	t.tlsAt = time.Now()
+	t.Unlock()
+}
+
+func (t *clientTrace) tlsHandshakeDone(_ tls.ConnectionState, err error) {
+	t.Lock()
+	start := t.tlsAt
+	t.Unlock()
+	if err == nil && !start.IsZero() {
+		t.tls.AddSince(start)
+	}
+}
+
+func (t *clientTrace) gotFirstResponseByte() {
+	t.response.AddSince(t.start)
+}
@@ -0,0 +1,78 @@
+package httpstat
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+
+	c := NewClient(metrics.NewRegister(), "http_client")
+	client := &http.Client{Transport: c.RoundTripper(srv.Client().Transport)}
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if got := c.requests("GET", "200").Get(); got != 2 {
+		t.Errorf("got %d GET 200 requests, want 2", got)
+	}
+	if got := c.requests("GET", "404").Get(); got != 1 {
+		t.Errorf("got %d GET 404 requests, want 1", got)
+	}
+	if got := c.inFlight.Get(); got != 0 {
+		t.Errorf("got %d requests in flight, want 0", got)
+	}
+	if _, count, _ := c.duration.Get(nil); count != 3 {
+		t.Errorf("got %d duration observations, want 3", count)
+	}
+	if _, count, _ := c.response.Get(nil); count != 3 {
+		t.Errorf("got %d first byte observations, want 3", count)
+	}
+	// connection reuse
+	if _, count, _ := c.connect.Get(nil); count != 1 {
+		t.Errorf("got %d connect observations, want 1", count)
+	}
+	if _, count, _ := c.tls.Get(nil); count != 1 {
+		t.Errorf("got %d TLS observations, want 1", count)
+	}
+	// IP address in URL
+	if _, count, _ := c.dns.Get(nil); count != 0 {
+		t.Errorf("got %d DNS observations, want 0", count)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // refuse connections
+
+	c := NewClient(metrics.NewRegister(), "http_client")
+	client := &http.Client{Transport: c.RoundTripper(nil)}
+	if _, err := client.Head(srv.URL); err == nil {
+		t.Fatal("no error on closed server")
+	}
+
+	if got := c.errors("HEAD").Get(); got != 1 {
+		t.Errorf("got %d HEAD errors, want 1", got)
+	}
+	if _, count, _ := c.duration.Get(nil); count != 0 {
+		t.Errorf("got %d duration observations, want 0", count)
+	}
+}
@@ -0,0 +1,226 @@
+// Package httpstat provides metrics for HTTP traffic.
+//
+// Labels come with a cost. Each unique combination of label values is a new
+// time series. Request methods are limited to the standard ones, and status
+// codes have a limited range by design. Routes are optional for that reason.
+package httpstat
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// LatencyBuckets are the upper boundaries for duration histograms in seconds.
+// Changes apply to new registrations only.
+var LatencyBuckets = metrics.DefBuckets
+
+// SizeBuckets are the upper boundaries for size histograms in bytes.
+// Changes apply to new registrations only.
+var SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// MethodLabel returns the request method for use as a label value. Methods
+// other than the ones defined in net/http are mapped to "OTHER", as clients
+// may send anything.
+func MethodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// Server has metrics for request handling. Multiple goroutines may invoke
+// methods on a Server simultaneously.
+type Server struct {
+	route func(*http.Request) string
+
+	requests     func(method, code, route string) *metrics.Counter
+	duration     func(route string) *metrics.Histogram
+	requestSize  func(route string) *metrics.Histogram
+	responseSize func(route string) *metrics.Histogram
+	inFlight     *metrics.Integer
+}
+
+// NewServer registers the following metrics on reg, with prefix as the name
+// start, e.g., "http_server".
+//
+//	<prefix>_requests_total{method,code[,route]} counter
+//	<prefix>_request_duration_seconds{[route]} histogram
+//	<prefix>_request_size_bytes{[route]} histogram
+//	<prefix>_response_size_bytes{[route]} histogram
+//	<prefix>_requests_in_flight gauge
+//
+// The route label is present only when route is not nil. The function should
+// return a small set of values, such as a path template, as opposed to the
+// actual URL path. Registration panics on name conflicts. Handlers which panic
+// without a response are counted with status code 500.
+func NewServer(reg *metrics.Register, prefix string, route func(*http.Request) string) *Server {
+	s := &Server{route: route}
+
+	if route == nil {
+		requests := reg.Must2LabelCounter(prefix+"_requests_total", "method", "code")
+		s.requests = func(method, code, _ string) *metrics.Counter {
+			return requests(method, code)
+		}
+
+		duration := reg.MustHistogram(prefix+"_request_duration_seconds", "", LatencyBuckets...)
+		s.duration = func(string) *metrics.Histogram { return duration }
+		requestSize := reg.MustHistogram(prefix+"_request_size_bytes", "", SizeBuckets...)
+		s.requestSize = func(string) *metrics.Histogram { return requestSize }
+		responseSize := reg.MustHistogram(prefix+"_response_size_bytes", "", SizeBuckets...)
+		s.responseSize = func(string) *metrics.Histogram { return responseSize }
+	} else {
+		s.requests = reg.Must3LabelCounter(prefix+"_requests_total", "method", "code", "route")
+		s.duration = reg.Must1LabelHistogram(prefix+"_request_duration_seconds", "route", LatencyBuckets...)
+		s.requestSize = reg.Must1LabelHistogram(prefix+"_request_size_bytes", "route", SizeBuckets...)
+		s.responseSize = reg.Must1LabelHistogram(prefix+"_response_size_bytes", "route", SizeBuckets...)
+	}
+	s.inFlight = reg.MustInteger(prefix+"_requests_in_flight", "Number of requests being served.")
+
+	reg.MustHelp(prefix+"_requests_total", "Number of requests served.")
+	reg.MustHelp(prefix+"_request_duration_seconds", "Time from request receival until handler return.")
+	reg.MustHelp(prefix+"_request_size_bytes", "Number of request body bytes read.")
+	reg.MustHelp(prefix+"_response_size_bytes", "Number of response body bytes written.")
+
+	return s
+}
+
+// Handler returns h with instrumentation.
+func (s *Server) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		var body *countingBody
+		if req.Body != nil && req.Body != http.NoBody {
+			body = &countingBody{ReadCloser: req.Body}
+			req.Body = body
+		}
+		w := &responseRecorder{ResponseWriter: resp}
+
+		var returned bool
+		defer func() {
+			var route string
+			if s.route != nil {
+				route = s.route(req)
+			}
+			code := w.statusCode
+			if code == 0 {
+				if returned {
+					code = http.StatusOK
+				} else {
+					code = http.StatusInternalServerError
+				}
+			}
+			s.requests(MethodLabel(req.Method), strconv.Itoa(code), route).Add(1)
+			s.duration(route).AddSince(start)
+			if body != nil {
+				s.requestSize(route).Add(float64(body.n))
+			} else {
+				s.requestSize(route).Add(0)
+			}
+			s.responseSize(route).Add(float64(w.written))
+		}()
+
+		h.ServeHTTP(w.wrap(), req)
+		returned = true
+	})
+}
+
+// CountingBody tracks the number of bytes read.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (body *countingBody) Read(p []byte) (n int, err error) {
+	n, err = body.ReadCloser.Read(p)
+	body.n += int64(n)
+	return
+}
+
+// ResponseRecorder tracks the status code and the number of bytes written.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int // zero when pending
+	written    int64
+}
+
+// Unwrap provides the original for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseRecorder) WriteHeader(statusCode int) {
+	// informational responses (1xx) may precede the final one
+	if w.statusCode == 0 && statusCode >= 200 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseRecorder) Write(p []byte) (n int, err error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err = w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return
+}
+
+// Wrap returns w with the optional http.Flusher and http.Hijacker of the
+// original, such that feature detection by type assertion keeps working.
+func (w *responseRecorder) wrap() http.ResponseWriter {
+	_, canFlush := w.ResponseWriter.(http.Flusher)
+	_, canHijack := w.ResponseWriter.(http.Hijacker)
+	switch {
+	case canFlush && canHijack:
+		return flushHijackRecorder{w}
+	case canFlush:
+		return flushRecorder{w}
+	case canHijack:
+		return hijackRecorder{w}
+	default:
+		return w
+	}
+}
+
+type flushRecorder struct{ *responseRecorder }
+
+type hijackRecorder struct{ *responseRecorder }
+
+type flushHijackRecorder struct{ *responseRecorder }
+
+// Flush implements http.Flusher.
+func (w flushRecorder) Flush() { w.flush() }
+
+// Flush implements http.Flusher.
+func (w flushHijackRecorder) Flush() { w.flush() }
+
+// Hijack implements http.Hijacker.
+func (w hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+// Hijack implements http.Hijacker.
+func (w flushHijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+func (w *responseRecorder) flush() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *responseRecorder) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && w.statusCode == 0 {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,152 @@
+package httpstat
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestServer(t *testing.T) {
+	reg := metrics.NewRegister()
+	s := NewServer(reg, "http_server", nil)
+
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := s.inFlight.Get(); got != 1 {
+			t.Errorf("got %d requests in flight, want 1", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write(body)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	if got := s.inFlight.Get(); got != 0 {
+		t.Errorf("got %d requests in flight after completion, want 0", got)
+	}
+	if got := s.requests("GET", "200", "").Get(); got != 1 {
+		t.Errorf("got %d GET 200 requests, want 1", got)
+	}
+	if got := s.requests("POST", "201", "").Get(); got != 1 {
+		t.Errorf("got %d POST 201 requests, want 1", got)
+	}
+	if got := s.requests("OTHER", "200", "").Get(); got != 1 {
+		t.Errorf("got %d OTHER 200 requests, want 1", got)
+	}
+	if _, count, _ := s.duration("").Get(nil); count != 3 {
+		t.Errorf("got %d duration observations, want 3", count)
+	}
+	if _, _, sum := s.requestSize("").Get(nil); sum != 5 {
+		t.Errorf("got request size sum %g, want 5", sum)
+	}
+	if _, _, sum := s.responseSize("").Get(nil); sum != 5 {
+		t.Errorf("got response size sum %g, want 5", sum)
+	}
+
+	metrics.SkipTimestamp = true
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	for _, want := range []string{
+		"\n# TYPE http_server_requests_total counter\n",
+		"\nhttp_server_requests_total{code=\"201\",method=\"POST\"} 1\n",
+		"\n# TYPE http_server_request_duration_seconds histogram\n",
+		"\nhttp_server_request_size_bytes_sum 5\n",
+		"\nhttp_server_requests_in_flight 0\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("serial misses %q", want)
+		}
+	}
+}
+
+func TestServerRoute(t *testing.T) {
+	reg := metrics.NewRegister()
+	s := NewServer(reg, "api", func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/user/") {
+			return "/user/{id}"
+		}
+		return "other"
+	})
+	h := s.Handler(http.NotFoundHandler())
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/2", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := s.requests("GET", "404", "/user/{id}").Get(); got != 2 {
+		t.Errorf("got %d user requests, want 2", got)
+	}
+	if got := s.requests("GET", "404", "other").Get(); got != 1 {
+		t.Errorf("got %d other requests, want 1", got)
+	}
+	if _, count, _ := s.duration("/user/{id}").Get(nil); count != 2 {
+		t.Errorf("got %d user duration observations, want 2", count)
+	}
+}
+
+func TestServerFlush(t *testing.T) {
+	s := NewServer(metrics.NewRegister(), "http_server", nil)
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !rec.Flushed {
+		t.Error("flush not passed on")
+	}
+	if got := s.requests("GET", "200", "").Get(); got != 1 {
+		t.Errorf("got %d GET 200 requests, want 1", got)
+	}
+}
+
+// PlainWriter has no optional interfaces.
+type plainWriter struct{ http.ResponseWriter }
+
+func TestServerOptionalInterfaces(t *testing.T) {
+	s := NewServer(metrics.NewRegister(), "http_server", nil)
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); ok {
+			t.Error("http.Flusher without support from the original")
+		}
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("http.Hijacker without support from the original")
+		}
+	}))
+	h.ServeHTTP(plainWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+}
+
+func TestServerPanic(t *testing.T) {
+	s := NewServer(metrics.NewRegister(), "http_server", nil)
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic not passed on")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	if got := s.requests("GET", "500", "").Get(); got != 1 {
+		t.Errorf("got %d GET 500 requests, want 1", got)
+	}
+	if _, count, _ := s.duration("").Get(nil); count != 1 {
+		t.Errorf("got %d duration observations, want 1", count)
+	}
+	if got := s.inFlight.Get(); got != 0 {
+		t.Errorf("got %d requests in flight after panic, want 0", got)
+	}
+}
@@ -0,0 +1,219 @@
+// Package influx provides metric exports in the InfluxDB line protocol.
+//
+// Conversion follows the Prometheus input of Telegraf (metric_version 1).
+// Each series becomes a point with the metric name as measurement, and with
+// the labels as tags. Counters have a "counter" field and gauges have a
+// "gauge" field. Histograms have a field per bucket bound, with cumulative
+// counts, plus "count" and "sum" fields. Summaries have a field per quantile,
+// plus "count" and "sum" fields.
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+	"github.com/pascaldekloe/metrics/internal/flatten"
+)
+
+// Writer serialises the content of a Register in the line protocol.
+// Multiple goroutines may invoke methods on a Writer simultaneously.
+type Writer struct {
+	reg *metrics.Register
+}
+
+// NewWriter returns a new Writer for reg. A nil reg defaults to the default
+// register of the metrics package.
+func NewWriter(reg *metrics.Register) *Writer {
+	return &Writer{reg: reg}
+}
+
+// WriteTo implements the io.WriterTo interface. Timestamps are in nanoseconds.
+// Samples keep their capture timestamp. All others get the timestamp of now.
+func (w *Writer) WriteTo(out io.Writer) (n int64, err error) {
+	var families []metrics.Family
+	if w.reg == nil {
+		families = metrics.Snapshot()
+	} else {
+		families = w.reg.Snapshot()
+	}
+
+	buf := appendPoints(nil, families, time.Now())
+	written, err := out.Write(buf)
+	return int64(written), err
+}
+
+func appendPoints(buf []byte, families []metrics.Family, now time.Time) []byte {
+	nowNanos := now.UnixNano()
+
+	var samples []flatten.Sample
+	for _, f := range families {
+		for i := range f.Series {
+			s := &f.Series[i]
+			timestamp := nowNanos
+			if s.Timestamp != 0 {
+				timestamp = int64(s.Timestamp) * int64(time.Millisecond)
+			}
+
+			mark := len(buf)
+			buf = appendEscaped(buf, f.Name, ", ")
+			for _, label := range flatten.SortedLabelNames(s.Labels) {
+				v := s.Labels[label]
+				if v == "" {
+					continue // not permitted
+				}
+				buf = append(buf, ',')
+				buf = appendEscaped(buf, label, ",= ")
+				buf = append(buf, '=')
+				buf = appendEscaped(buf, v, ",= ")
+			}
+
+			fieldMark := len(buf)
+			samples = flatten.AppendSamples(samples[:0], f.Type, s)
+			for _, sample := range samples {
+				// bucket bound, quantile, "count", "sum" or the type
+				key := sample.LabelValue
+				if key == "" {
+					key = strings.TrimPrefix(sample.Suffix, "_")
+				}
+				if key == "" {
+					key = f.Type
+				}
+				buf = appendField(buf, fieldMark, key, sample.Value)
+			}
+			if len(buf) == fieldMark {
+				// no fields is not permitted
+				buf = buf[:mark]
+				continue
+			}
+
+			buf = append(buf, ' ')
+			buf = strconv.AppendInt(buf, timestamp, 10)
+			buf = append(buf, '\n')
+		}
+	}
+	return buf
+}
+
+// AppendField appends a float field, with fieldMark as the offset of the
+// field set in buf. NaN and infinity are not supported by InfluxDB.
+func appendField(buf []byte, fieldMark int, key string, value float64) []byte {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return buf
+	}
+	if len(buf) == fieldMark {
+		buf = append(buf, ' ')
+	} else {
+		buf = append(buf, ',')
+	}
+	buf = appendEscaped(buf, key, ",= ")
+	buf = append(buf, '=')
+	return strconv.AppendFloat(buf, value, 'g', -1, 64)
+}
+
+// AppendEscaped appends s with a backslash before each of the special
+// characters. Newlines are not supported, and they get replaced by a space.
+func appendEscaped(buf []byte, s, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\n':
+			c = ' '
+			fallthrough
+		case strings.IndexByte(special, c) >= 0:
+			buf = append(buf, '\\', c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// Client pushes the content of a Register to an InfluxDB write endpoint.
+// Multiple goroutines may invoke methods on a Client simultaneously.
+type Client struct {
+	// URL is the write endpoint, including any query parameters, e.g.,
+	// "http://localhost:8086/write?db=mydb" or, with version 2,
+	// "http://localhost:8086/api/v2/write?org=myorg&bucket=mybucket".
+	URL string
+
+	// Header is added to each request, e.g., for Authorization.
+	Header http.Header
+
+	// HTTPClient is used for requests. The nil value defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	w *Writer
+}
+
+// NewClient returns a new Client which pushes the content of reg to url.
+// A nil reg defaults to the default register of the metrics package.
+func NewClient(reg *metrics.Register, url string) *Client {
+	return &Client{URL: url, w: NewWriter(reg)}
+}
+
+// Push sends a snapshot with nanosecond precision. Responses other than 2xx
+// are returned as an error.
+func (c *Client) Push() error {
+	var body bytes.Buffer
+	if _, err := c.w.WriteTo(&body); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, &body)
+	if err != nil {
+		return fmt.Errorf("influx: %w", err)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx: write endpoint status %q: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// PushEvery sends a snapshot with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel.
+func (c *Client) PushEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		c.Push()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				c.Push()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
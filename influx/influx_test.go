@@ -0,0 +1,87 @@
+package influx
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestAppendPoints(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.Must2LabelCounter("requests_total", "method", "path")("GET", "/a,b=c d").Add(2)
+	reg.MustRealSample("temperature", "").Set(21.5, time.UnixMilli(1615130567389))
+	h := reg.MustHistogram("latency_seconds", "", 0.1, 1)
+	h.Add(0.05)
+	h.Add(5)
+	reg.MustSummarySample("gc_seconds", "", 0.5).Set([]float64{0.25}, 4, 1, time.UnixMilli(1615130567389))
+
+	got := string(appendPoints(nil, reg.Snapshot(), time.Unix(1615130568, 0)))
+	want := `requests_total,method=GET,path=/a\,b\=c\ d counter=2 1615130568000000000
+temperature gauge=21.5 1615130567389000000
+latency_seconds 0.1=1,1=1,+Inf=2,count=2,sum=5.05 1615130568000000000
+gc_seconds 0.5=0.25,count=4,sum=1 1615130567389000000
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestAppendPointsNaN verifies that unsupported values are omitted.
+func TestAppendPointsNaN(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.MustReal("nan", "").Set(math.NaN())
+	reg.MustRealSample("inf", "").Set(math.Inf(1), time.Now())
+	reg.MustHistogram("empty", "")
+
+	got := string(appendPoints(nil, reg.Snapshot(), time.Unix(1, 0)))
+	want := "empty +Inf=0,count=0,sum=0 1000000000\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPush(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.MustCounter("hits_total", "").Add(3)
+
+	var gotMethod, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		if r.URL.Query().Get("db") != "test" {
+			http.Error(w, "database not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(reg, srv.URL+"/write?db=test")
+	c.Header = http.Header{"Authorization": {"Token secret"}}
+	if err := c.Push(); err != nil {
+		t.Fatal("push error:", err)
+	}
+	if gotMethod != http.MethodPost {
+		t.Errorf("got method %q, want POST", gotMethod)
+	}
+	if gotAuth != "Token secret" {
+		t.Errorf("got Authorization %q, want header from Client", gotAuth)
+	}
+	if !strings.HasPrefix(gotBody, "hits_total counter=3 ") {
+		t.Errorf("got body %q, want hits_total counter", gotBody)
+	}
+
+	c.URL = srv.URL + "/write?db=other"
+	err := c.Push()
+	if err == nil || !strings.Contains(err.Error(), "database not found") {
+		t.Errorf("got error %v, want status 404 with message", err)
+	}
+}
@@ -0,0 +1,48 @@
+// Package bounds provides the histogram bucket bound handling shared by the
+// metrics package and its extensions.
+package bounds
+
+import (
+	"math"
+	"sort"
+)
+
+// Normalize returns the bucket bounds in ascending order, without duplicates,
+// and without any not-a-number (NaN) or positive infinity values. The argument
+// is not modified.
+func Normalize(bucketBounds []float64) []float64 {
+	// Use copy of bucketBounds to prevent unexpected mutations,
+	// in case the variadic was invoked with a collapsed slice.
+	var a []float64
+	for _, f := range bucketBounds {
+		// skip NaN and ∞
+		if f == f && f <= math.MaxFloat64 {
+			a = append(a, f)
+		}
+	}
+	if len(a) < 2 {
+		return a
+	}
+
+	sort.Float64s(a)
+	bucketBounds = a[:1]
+	for _, f := range a[1:] {
+		if f > bucketBounds[len(bucketBounds)-1] {
+			bucketBounds = append(bucketBounds, f)
+		}
+	}
+	return bucketBounds
+}
+
+// Equal returns whether a and b have the same bounds in the same order.
+func Equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package bounds
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	golden := []struct{ bounds, want []float64 }{
+		{nil, nil},
+		{[]float64{1}, []float64{1}},
+		{[]float64{math.NaN(), math.Inf(1)}, nil},
+		{[]float64{4, 1, 2, 1, math.NaN(), 2}, []float64{1, 2, 4}},
+	}
+	for _, gold := range golden {
+		arg := append([]float64(nil), gold.bounds...)
+		got := Normalize(arg)
+		if !reflect.DeepEqual(got, gold.want) {
+			t.Errorf("got %v for %v, want %v", got, gold.bounds, gold.want)
+		}
+		if !Equal(got, gold.want) {
+			t.Errorf("Equal(%v, %v) = false", got, gold.want)
+		}
+		for i := range arg {
+			if arg[i] != gold.bounds[i] && !math.IsNaN(arg[i]) {
+				t.Errorf("argument %v modified to %v", gold.bounds, arg)
+				break
+			}
+		}
+	}
+
+	if Equal([]float64{1, 2}, []float64{1}) || Equal([]float64{1, 2}, []float64{2, 1}) {
+		t.Error("Equal true on other bounds")
+	}
+}
@@ -0,0 +1,80 @@
+// Package flatten provides the samples of a metrics.Series, as the Prometheus
+// exposition has them, for exports in other formats.
+package flatten
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Sample is a single value from a series.
+type Sample struct {
+	// Suffix is appended to the metric name: "_bucket", "_count", "_sum",
+	// or none.
+	Suffix string
+	// Histogram buckets have an "le" label. Summary quantiles have a
+	// "quantile" label. LabelName is empty otherwise.
+	LabelName, LabelValue string
+
+	Value float64
+}
+
+// Labels returns the labels of a series, including the label of the sample,
+// if any. The series labels are not modified.
+func (sample *Sample) Labels(series map[string]string) map[string]string {
+	if sample.LabelName == "" {
+		return series
+	}
+	return WithLabel(series, sample.LabelName, sample.LabelValue)
+}
+
+// AppendSamples adds the samples of s, with typ as the type of its family.
+// Histograms get a cumulative count for each bucket, including positive
+// infinity, followed by the count and the sum. Summaries get their quantiles,
+// followed by the count and the sum.
+func AppendSamples(a []Sample, typ string, s *metrics.Series) []Sample {
+	switch typ {
+	case "histogram":
+		var cumulative uint64
+		for i, bound := range s.BucketBounds {
+			cumulative += s.Buckets[i]
+			a = append(a, Sample{"_bucket", "le", strconv.FormatFloat(bound, 'g', -1, 64), float64(cumulative)})
+		}
+		a = append(a, Sample{"_bucket", "le", "+Inf", float64(s.Count)})
+
+	case "summary":
+		for i, q := range s.Quantiles {
+			a = append(a, Sample{"", "quantile", strconv.FormatFloat(q, 'g', -1, 64), s.QuantileValues[i]})
+		}
+
+	default:
+		return append(a, Sample{Value: s.Value})
+	}
+
+	return append(a,
+		Sample{Suffix: "_count", Value: float64(s.Count)},
+		Sample{Suffix: "_sum", Value: s.Sum},
+	)
+}
+
+// WithLabel returns a copy of labels with one more entry.
+func WithLabel(labels map[string]string, name, value string) map[string]string {
+	c := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		c[k] = v
+	}
+	c[name] = value
+	return c
+}
+
+// SortedLabelNames returns the keys of labels in ascending order.
+func SortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
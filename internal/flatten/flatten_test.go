@@ -0,0 +1,38 @@
+package flatten
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestAppendSamples(t *testing.T) {
+	histogram := metrics.Series{BucketBounds: []float64{0.5, 1}, Buckets: []uint64{2, 1}, Count: 4, Sum: 7}
+	summary := metrics.Series{Quantiles: []float64{0.99}, QuantileValues: []float64{3}, Count: 9, Sum: 12}
+	gauge := metrics.Series{Value: -2}
+
+	got := AppendSamples(nil, "histogram", &histogram)
+	got = AppendSamples(got, "summary", &summary)
+	got = AppendSamples(got, "gauge", &gauge)
+	want := []Sample{
+		{"_bucket", "le", "0.5", 2},
+		{"_bucket", "le", "1", 3},
+		{"_bucket", "le", "+Inf", 4},
+		{"_count", "", "", 4},
+		{"_sum", "", "", 7},
+		{"", "quantile", "0.99", 3},
+		{"_count", "", "", 9},
+		{"_sum", "", "", 12},
+		{"", "", "", -2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v", got)
+		t.Errorf("want %+v", want)
+	}
+
+	series := map[string]string{"a": "b"}
+	if got := got[0].Labels(series); len(got) != 2 || got["le"] != "0.5" || len(series) != 1 {
+		t.Errorf("got labels %q from series %q", got, series)
+	}
+}
@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// WriteJSON serialises a sample of each metric in a JSON document as an
+// io.WriterTo. See Register.WriteJSON for the structure.
+func WriteJSON(w io.Writer) (n int64, err error) {
+	return std.WriteJSON(w)
+}
+
+// WriteJSON serialises a sample of each metric in a JSON document as an
+// io.WriterTo. The content matches Snapshot, with families in order of
+// appearance, e.g.:
+//
+//	{"families":[
+//	{"name":"http_requests_total","type":"counter","help":"Requests served.","series":[
+//	{"labels":{"method":"GET"},"value":42}]},
+//	{"name":"http_latency_seconds","type":"histogram","series":[
+//	{"buckets":[{"le":0.1,"count":3},{"le":"+Inf","count":4}],"count":4,"sum":1.9}]},
+//	{"name":"gc_duration_seconds","type":"summary","series":[
+//	{"timestamp":1615130567389,"quantiles":[{"quantile":0.5,"value":0.002}],"count":7,"sum":0.02}]}
+//	]}
+//
+// Bucket counts are cumulative. Timestamps, in Unix milliseconds, are present
+// on samples only. NaN and infinity values are encoded as the strings "NaN",
+// "+Inf" and "-Inf". Invalid UTF-8 in label values is replaced with U+FFFD.
+func (reg *Register) WriteJSON(w io.Writer) (n int64, err error) {
+	return reg.writeFilteredJSON(w, nil)
+}
+
+func (reg *Register) writeFilteredJSON(w io.Writer, filter func(name string) bool) (n int64, err error) {
+	buf := append(make([]byte, 0, 512), `{"families":[`...)
+	for i, f := range reg.snapshot(filter) {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '\n')
+		buf = f.appendJSON(buf)
+	}
+	buf = append(buf, "\n]}\n"...)
+
+	wn, err := w.Write(buf)
+	return int64(wn), err
+}
+
+func (f *Family) appendJSON(buf []byte) []byte {
+	buf = append(buf, `{"name":`...)
+	buf = appendJSONString(buf, f.Name)
+	buf = append(buf, `,"type":`...)
+	buf = appendJSONString(buf, f.Type)
+	if f.Help != "" {
+		buf = append(buf, `,"help":`...)
+		buf = appendJSONString(buf, f.Help)
+	}
+	buf = append(buf, `,"series":[`...)
+	for i := range f.Series {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '\n')
+		buf = f.Series[i].appendJSON(buf, f.Type)
+	}
+	return append(buf, "]}"...)
+}
+
+func (s *Series) appendJSON(buf []byte, typ string) []byte {
+	buf = append(buf, '{')
+	if len(s.Labels) != 0 {
+		buf = append(buf, `"labels":{`...)
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			if i != 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, name)
+			buf = append(buf, ':')
+			buf = appendJSONString(buf, s.Labels[name])
+		}
+		buf = append(buf, "},"...)
+	}
+	if s.Timestamp != 0 {
+		buf = append(buf, `"timestamp":`...)
+		buf = strconv.AppendUint(buf, s.Timestamp, 10)
+		buf = append(buf, ',')
+	}
+
+	switch typ {
+	case "histogram":
+		buf = append(buf, `"buckets":[`...)
+		var cumulative uint64
+		for i, bound := range s.BucketBounds {
+			cumulative += s.Buckets[i]
+			buf = append(buf, `{"le":`...)
+			buf = appendJSONFloat(buf, bound)
+			buf = append(buf, `,"count":`...)
+			buf = strconv.AppendUint(buf, cumulative, 10)
+			buf = append(buf, "},"...)
+		}
+		buf = append(buf, `{"le":"+Inf","count":`...)
+		buf = strconv.AppendUint(buf, s.Count, 10)
+		buf = append(buf, "}],"...)
+		buf = appendJSONCountAndSum(buf, s.Count, s.Sum)
+
+	case "summary":
+		buf = append(buf, `"quantiles":[`...)
+		for i, q := range s.Quantiles {
+			if i != 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `{"quantile":`...)
+			buf = appendJSONFloat(buf, q)
+			buf = append(buf, `,"value":`...)
+			buf = appendJSONFloat(buf, s.QuantileValues[i])
+			buf = append(buf, '}')
+		}
+		buf = append(buf, "],"...)
+		buf = appendJSONCountAndSum(buf, s.Count, s.Sum)
+
+	default:
+		buf = append(buf, `"value":`...)
+		buf = appendJSONFloat(buf, s.Value)
+	}
+	return append(buf, '}')
+}
+
+func appendJSONCountAndSum(buf []byte, count uint64, sum float64) []byte {
+	buf = append(buf, `"count":`...)
+	buf = strconv.AppendUint(buf, count, 10)
+	buf = append(buf, `,"sum":`...)
+	return appendJSONFloat(buf, sum)
+}
+
+func appendJSONFloat(buf []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(buf, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(buf, `"+Inf"`...)
+	case math.IsInf(f, -1):
+		return append(buf, `"-Inf"`...)
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, 64)
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"', c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < ' ', c == 0x7f:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
+
+// AcceptsJSON returns whether an HTTP Accept header prefers JSON over the
+// text format.
+func acceptsJSON(accept string) bool {
+	var jsonQ, textQ float64 = 0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = math.Max(jsonQ, q)
+		case "text/plain", "text/*", "*/*":
+			textQ = math.Max(textQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > textQ
+}
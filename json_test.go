@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func ExampleRegister_WriteJSON() {
+	demo := metrics.NewRegister()
+	demo.Must1LabelCounter("http_requests_total", "method")("GET").Add(42)
+	demo.MustHelp("http_requests_total", "Requests served.")
+	latency := demo.MustHistogram("http_latency_seconds", "", 0.1)
+	latency.Add(0.05)
+	latency.Add(0.2)
+	demo.MustRealSample("temperature_celsius", "").Set(math.NaN(), time.UnixMilli(1615130567389))
+
+	demo.WriteJSON(os.Stdout)
+	// Output:
+	// {"families":[
+	// {"name":"http_requests_total","type":"counter","help":"Requests served.","series":[
+	// {"labels":{"method":"GET"},"value":42}]},
+	// {"name":"http_latency_seconds","type":"histogram","series":[
+	// {"buckets":[{"le":0.1,"count":1},{"le":"+Inf","count":2}],"count":2,"sum":0.25}]},
+	// {"name":"temperature_celsius","type":"gauge","series":[
+	// {"timestamp":1615130567389,"value":"NaN"}]}
+	// ]}
+}
+
+func TestWriteJSONValid(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.Must1LabelCounter("raw", "v")("\"\\\n\t\x00\x7f\xff π").Add(1)
+	reg.MustHelp("raw", "<escape>\n")
+	reg.MustSummarySample("q", "", 0.5, 0.9).Set([]float64{1, math.Inf(1)}, 2, 3, time.Now())
+	reg.MustInteger("empty", "")
+
+	var buf bytes.Buffer
+	n, err := reg.WriteJSON(&buf)
+	if err != nil {
+		t.Fatal("write error:", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("n = %d with %d bytes written", n, buf.Len())
+	}
+
+	var doc struct {
+		Families []struct {
+			Name, Type, Help string
+			Series           []struct {
+				Labels    map[string]string
+				Quantiles []struct{ Quantile, Value any }
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %s", buf.Bytes(), err)
+	}
+	if len(doc.Families) != 3 {
+		t.Fatalf("got %d families, want 3", len(doc.Families))
+	}
+	if got, want := doc.Families[0].Series[0].Labels["v"], "\"\\\n\t\x00\x7f� π"; got != want {
+		t.Errorf("got label value %q, want %q", got, want)
+	}
+	if got := doc.Families[0].Help; got != "<escape>\n" {
+		t.Errorf("got help %q", got)
+	}
+	if got := doc.Families[1].Series[0].Quantiles[1].Value; got != "+Inf" {
+		t.Errorf("got quantile value %v, want +Inf", got)
+	}
+}
+
+func TestServeHTTPJSON(t *testing.T) {
+	metrics.SkipTimestamp = true
+	reg := metrics.NewRegister()
+	reg.MustCounter("a_total", "").Add(1)
+	reg.MustCounter("b_total", "").Add(2)
+
+	golden := []struct {
+		accept   string
+		wantJSON bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"text/plain;version=0.0.4;q=0.5,application/json", true},
+		{"application/json;q=0.5,text/plain", false},
+		{"application/json;q=0.5,*/*;q=0.1", true},
+		{"application/json;q=0", false},
+		{"application/openmetrics-text;version=1.0.0,*/*;q=0.1", false},
+	}
+	for _, gold := range golden {
+		req := httptest.NewRequest("GET", "/metrics?name[]=b_*", nil)
+		req.Header.Set("Accept", gold.accept)
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, req)
+
+		contentType := rec.Result().Header.Get("Content-Type")
+		if gotJSON := contentType == "application/json"; gotJSON != gold.wantJSON {
+			t.Errorf("Accept %q got Content-Type %q", gold.accept, contentType)
+			continue
+		}
+		if gold.wantJSON {
+			const want = "{\"families\":[\n{\"name\":\"b_total\",\"type\":\"counter\",\"series\":[\n{\"value\":2}]}\n]}\n"
+			if got := rec.Body.String(); got != want {
+				t.Errorf("Accept %q got body %q, want %q", gold.accept, got, want)
+			}
+		}
+	}
+}
@@ -12,11 +12,16 @@ type labelMapping struct {
 	labelNames  [3]string
 	labelHashes []uint64
 
-	counters   []*Counter
-	integers   []*Integer
-	reals      []*Real
-	samples    []*Sample
-	histograms []*Histogram
+	counters        []*Counter
+	integers        []*Integer
+	reals           []*Real
+	realCounters    []*RealCounter
+	shardedCounters []*ShardedCounter
+	shardedIntegers []*ShardedInteger
+	samples         []*Sample
+	histograms      []*Histogram
+
+	histogramSamples []*HistogramSample
 
 	buckets []float64
 }
@@ -129,6 +134,114 @@ func (mapping *labelMapping) real123(value1, value2, value3 string) *Real {
 	return m
 }
 
+func (mapping *labelMapping) realCounter1(value string) *RealCounter {
+	i := mapping.lockIndex1(value)
+	defer mapping.Unlock()
+	if i < len(mapping.realCounters) {
+		return mapping.realCounters[i]
+	}
+
+	m := &RealCounter{prefix: mapping.format1LabelPrefix(value)}
+	mapping.realCounters = append(mapping.realCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) realCounter12(value1, value2 string) *RealCounter {
+	i := mapping.lockIndex12(value1, value2)
+	defer mapping.Unlock()
+	if i < len(mapping.realCounters) {
+		return mapping.realCounters[i]
+	}
+
+	m := &RealCounter{prefix: mapping.format2LabelPrefix(value1, value2)}
+	mapping.realCounters = append(mapping.realCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) realCounter123(value1, value2, value3 string) *RealCounter {
+	i := mapping.lockIndex123(value1, value2, value3)
+	defer mapping.Unlock()
+	if i < len(mapping.realCounters) {
+		return mapping.realCounters[i]
+	}
+
+	m := &RealCounter{prefix: mapping.format3LabelPrefix(value1, value2, value3)}
+	mapping.realCounters = append(mapping.realCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedCounter1(value string) *ShardedCounter {
+	i := mapping.lockIndex1(value)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedCounters) {
+		return mapping.shardedCounters[i]
+	}
+
+	m := newShardedCounter(mapping.format1LabelPrefix(value))
+	mapping.shardedCounters = append(mapping.shardedCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedCounter12(value1, value2 string) *ShardedCounter {
+	i := mapping.lockIndex12(value1, value2)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedCounters) {
+		return mapping.shardedCounters[i]
+	}
+
+	m := newShardedCounter(mapping.format2LabelPrefix(value1, value2))
+	mapping.shardedCounters = append(mapping.shardedCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedCounter123(value1, value2, value3 string) *ShardedCounter {
+	i := mapping.lockIndex123(value1, value2, value3)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedCounters) {
+		return mapping.shardedCounters[i]
+	}
+
+	m := newShardedCounter(mapping.format3LabelPrefix(value1, value2, value3))
+	mapping.shardedCounters = append(mapping.shardedCounters, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedInteger1(value string) *ShardedInteger {
+	i := mapping.lockIndex1(value)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedIntegers) {
+		return mapping.shardedIntegers[i]
+	}
+
+	m := newShardedInteger(mapping.format1LabelPrefix(value))
+	mapping.shardedIntegers = append(mapping.shardedIntegers, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedInteger12(value1, value2 string) *ShardedInteger {
+	i := mapping.lockIndex12(value1, value2)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedIntegers) {
+		return mapping.shardedIntegers[i]
+	}
+
+	m := newShardedInteger(mapping.format2LabelPrefix(value1, value2))
+	mapping.shardedIntegers = append(mapping.shardedIntegers, m)
+	return m
+}
+
+func (mapping *labelMapping) shardedInteger123(value1, value2, value3 string) *ShardedInteger {
+	i := mapping.lockIndex123(value1, value2, value3)
+	defer mapping.Unlock()
+	if i < len(mapping.shardedIntegers) {
+		return mapping.shardedIntegers[i]
+	}
+
+	m := newShardedInteger(mapping.format3LabelPrefix(value1, value2, value3))
+	mapping.shardedIntegers = append(mapping.shardedIntegers, m)
+	return m
+}
+
 func (mapping *labelMapping) sample1(value string) *Sample {
 	i := mapping.lockIndex1(value)
 	defer mapping.Unlock()
@@ -212,6 +325,51 @@ func (mapping *labelMapping) histogram12(value1, value2 string) *Histogram {
 	return h
 }
 
+func (mapping *labelMapping) histogramSample1(value string) *HistogramSample {
+	i := mapping.lockIndex1(value)
+	defer mapping.Unlock()
+	if i < len(mapping.histogramSamples) {
+		return mapping.histogramSamples[i]
+	}
+
+	h := newHistogramSample(mapping.name, mapping.buckets)
+
+	// set prefixes
+	tail := `",` + mapping.labelNames[0] + `="` + valueEscapes.Replace(value) + `"} `
+	for i, f := range h.BucketBounds {
+		h.bucketPrefixes[i] = mapping.name + `{le="` + strconv.FormatFloat(f, 'g', -1, 64) + tail
+	}
+	h.bucketPrefixes[len(h.BucketBounds)] = mapping.name + `{le="+Inf` + tail
+	h.countPrefix = mapping.name + "_count{" + tail[2:]
+	h.sumPrefix = mapping.name + "_sum{" + tail[2:]
+
+	mapping.histogramSamples = append(mapping.histogramSamples, h)
+	return h
+}
+
+func (mapping *labelMapping) histogramSample12(value1, value2 string) *HistogramSample {
+	i := mapping.lockIndex12(value1, value2)
+	defer mapping.Unlock()
+	if i < len(mapping.histogramSamples) {
+		return mapping.histogramSamples[i]
+	}
+
+	h := newHistogramSample(mapping.name, mapping.buckets)
+
+	// set prefixes
+	tail := `",` + mapping.labelNames[0] + `="` + valueEscapes.Replace(value1)
+	tail += `",` + mapping.labelNames[1] + `="` + valueEscapes.Replace(value2) + `"} `
+	for i, f := range h.BucketBounds {
+		h.bucketPrefixes[i] = mapping.name + `{le="` + strconv.FormatFloat(f, 'g', -1, 64) + tail
+	}
+	h.bucketPrefixes[len(h.BucketBounds)] = mapping.name + `{le="+Inf` + tail
+	h.countPrefix = mapping.name + "_count{" + tail[2:]
+	h.sumPrefix = mapping.name + "_sum{" + tail[2:]
+
+	mapping.histogramSamples = append(mapping.histogramSamples, h)
+	return h
+}
+
 // 64-Bit FNV
 const (
 	hashOffset = 14695981039346656037
@@ -430,6 +588,63 @@ func (mapping *labelMapping) real231(v2, v3, v1 string) *Real { return mapping.r
 func (mapping *labelMapping) real312(v3, v1, v2 string) *Real { return mapping.real123(v1, v2, v3) }
 func (mapping *labelMapping) real321(v3, v2, v1 string) *Real { return mapping.real123(v1, v2, v3) }
 
+func (mapping *labelMapping) realCounter21(v2, v1 string) *RealCounter {
+	return mapping.realCounter12(v1, v2)
+}
+func (mapping *labelMapping) realCounter132(v1, v3, v2 string) *RealCounter {
+	return mapping.realCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) realCounter213(v2, v1, v3 string) *RealCounter {
+	return mapping.realCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) realCounter231(v2, v3, v1 string) *RealCounter {
+	return mapping.realCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) realCounter312(v3, v1, v2 string) *RealCounter {
+	return mapping.realCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) realCounter321(v3, v2, v1 string) *RealCounter {
+	return mapping.realCounter123(v1, v2, v3)
+}
+
+func (mapping *labelMapping) shardedCounter21(v2, v1 string) *ShardedCounter {
+	return mapping.shardedCounter12(v1, v2)
+}
+func (mapping *labelMapping) shardedCounter132(v1, v3, v2 string) *ShardedCounter {
+	return mapping.shardedCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedCounter213(v2, v1, v3 string) *ShardedCounter {
+	return mapping.shardedCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedCounter231(v2, v3, v1 string) *ShardedCounter {
+	return mapping.shardedCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedCounter312(v3, v1, v2 string) *ShardedCounter {
+	return mapping.shardedCounter123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedCounter321(v3, v2, v1 string) *ShardedCounter {
+	return mapping.shardedCounter123(v1, v2, v3)
+}
+
+func (mapping *labelMapping) shardedInteger21(v2, v1 string) *ShardedInteger {
+	return mapping.shardedInteger12(v1, v2)
+}
+func (mapping *labelMapping) shardedInteger132(v1, v3, v2 string) *ShardedInteger {
+	return mapping.shardedInteger123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedInteger213(v2, v1, v3 string) *ShardedInteger {
+	return mapping.shardedInteger123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedInteger231(v2, v3, v1 string) *ShardedInteger {
+	return mapping.shardedInteger123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedInteger312(v3, v1, v2 string) *ShardedInteger {
+	return mapping.shardedInteger123(v1, v2, v3)
+}
+func (mapping *labelMapping) shardedInteger321(v3, v2, v1 string) *ShardedInteger {
+	return mapping.shardedInteger123(v1, v2, v3)
+}
+
 func (mapping *labelMapping) sample21(v2, v1 string) *Sample { return mapping.sample12(v1, v2) }
 func (mapping *labelMapping) sample132(v1, v3, v2 string) *Sample {
 	return mapping.sample123(v1, v2, v3)
@@ -450,3 +665,7 @@ func (mapping *labelMapping) sample321(v3, v2, v1 string) *Sample {
 func (mapping *labelMapping) histogram21(v2, v1 string) *Histogram {
 	return mapping.histogram12(v1, v2)
 }
+
+func (mapping *labelMapping) histogramSample21(v2, v1 string) *HistogramSample {
+	return mapping.histogramSample12(v1, v2)
+}
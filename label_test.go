@@ -21,6 +21,11 @@ func TestLabels(t *testing.T) {
 		t.Errorf(`got %q, want {"a": "\\", "b": "\n", "c": "\""}`, got)
 	}
 
+	switch got := reg.Must1LabelHistogram("histogram", "foo", 1, 2)("bar").Labels(); {
+	case len(got) != 1, got["foo"] != "bar":
+		t.Errorf(`histogram got %q, want {"foo": "bar"}`, got)
+	}
+
 	// values may contain *any* byte sequence
 	var all [256]byte
 	for i := range all {
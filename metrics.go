@@ -2,7 +2,7 @@
 //
 // Counter, Integer, Real and Histogram are live representations of events.
 // Value updates should be part of the respective implementation. Otherwise,
-// use Sample for captures with a timestamp.
+// use Sample, SummarySample or HistogramSample for captures with a timestamp.
 //
 // The Must functions deal with registration. Their use is intended for setup
 // during application launch only.
@@ -10,14 +10,16 @@
 package metrics
 
 import (
+	"errors"
 	"math"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/pascaldekloe/metrics/internal/bounds"
 )
 
 // Serialisation Byte Limits
@@ -55,6 +57,18 @@ type Real struct {
 	prefix string
 }
 
+// RealCounter is a cumulative metric that represents a single monotonically
+// increasing counter whose value can only increase or be reset to zero on
+// restart. In contrast to Counter, increments may be fractional, like seconds
+// of CPU time. Negative and not-a-number (NaN) increments are dropped. The
+// default/initial value is zero. Multiple goroutines may invoke methods on a
+// RealCounter simultaneously.
+type RealCounter struct {
+	valueBits atomic.Uint64
+	// fixed start of serial line is <name> <label-map>? ' '
+	prefix string
+}
+
 // Sample is a specialised metric for measurement captures, as opposed to
 // holding the current value at all times. The precision is enhanced with
 // a timestamp, at the cost of performance degradation. Serialisation
@@ -62,13 +76,94 @@ type Real struct {
 // with a zero timestamp.
 // Multiple goroutines may invoke methods on a Sample simultaneously.
 type Sample struct {
-	mux       sync.Mutex
-	value     float64 // current capture
-	timestamp uint64  // capture moment
+	// Sequence number is odd during updates. Readers retry when the
+	// number changed during their loads.
+	seq       atomic.Uint64
+	valueBits atomic.Uint64 // current capture
+	timestamp atomic.Uint64 // capture moment
 	// fixed start of serial line is <name> <label-map>? ' '
 	prefix string
 }
 
+// SummarySample is a specialised metric for captures of quantiles, as
+// opposed to live observations. Serialisation omits samples with a zero
+// timestamp. The default/initial value is zero with a zero timestamp.
+// Multiple goroutines may invoke methods on a SummarySample simultaneously.
+type SummarySample struct {
+	mux       sync.Mutex
+	values    []float64 // current capture for each Quantiles
+	count     uint64    // current capture
+	sum       float64   // current capture
+	timestamp uint64    // capture moment
+
+	// Quantile ranks of the values, sorted, within [0, 1].
+	// This field is read-only.
+	Quantiles []float64
+
+	// fixed start of each serial line is <name> '{quantile="' … '"} '
+	quantilePrefixes []string
+	// fixed start of serial line is <name> '_sum '
+	sumPrefix string
+	// fixed start of serial line is <name> '_count '
+	countPrefix string
+}
+
+func newSummarySample(name string, quantiles []float64) *SummarySample {
+	for i, q := range quantiles {
+		if !(q >= 0 && q <= 1) || i != 0 && q <= quantiles[i-1] {
+			panic("metrics: quantiles not in ascending order within [0, 1]")
+		}
+	}
+
+	m := SummarySample{
+		values: make([]float64, len(quantiles)),
+		// copy prevents unexpected mutations
+		Quantiles:        append([]float64(nil), quantiles...),
+		quantilePrefixes: make([]string, len(quantiles)),
+		sumPrefix:        name + "_sum ",
+		countPrefix:      name + "_count ",
+	}
+	for i, q := range quantiles {
+		m.quantilePrefixes[i] = name + `{quantile="` + strconv.FormatFloat(q, 'g', -1, 64) + `"} `
+	}
+	return &m
+}
+
+// HistogramSample is a specialised metric for captures of distributions, as
+// opposed to live observations with a Histogram. Serialisation omits samples
+// with a zero timestamp. The default/initial value is zero with a zero
+// timestamp.
+// Multiple goroutines may invoke methods on a HistogramSample simultaneously.
+type HistogramSample struct {
+	mux       sync.Mutex
+	buckets   []uint64 // current capture for each BucketBounds
+	count     uint64   // current capture
+	sum       float64  // current capture
+	timestamp uint64   // capture moment
+
+	// Upper value for each bucket, sorted, +Inf omitted.
+	// This field is read-only.
+	BucketBounds []float64
+
+	// fixed start of each serial line is <name> '{le="' … '"} '
+	bucketPrefixes []string // including +Inf
+	// fixed start of serial line is <name> '_sum '
+	sumPrefix string
+	// fixed start of serial line is <name> '_count '
+	countPrefix string
+}
+
+func newHistogramSample(name string, bucketBounds []float64) *HistogramSample {
+	bucketBounds = bounds.Normalize(bucketBounds)
+	return &HistogramSample{
+		buckets:        make([]uint64, len(bucketBounds)),
+		BucketBounds:   bucketBounds,
+		bucketPrefixes: formatBucketPrefixes(name, bucketBounds),
+		countPrefix:    name + "_count ",
+		sumPrefix:      name + "_sum ",
+	}
+}
+
 func parseMetricName(s string) string {
 	i := strings.IndexAny(s, " {")
 	if i >= 0 {
@@ -86,9 +181,18 @@ func (m *Integer) Name() string { return parseMetricName(m.prefix) }
 // Name returns the metric identifier.
 func (m *Real) Name() string { return parseMetricName(m.prefix) }
 
+// Name returns the metric identifier.
+func (m *RealCounter) Name() string { return parseMetricName(m.prefix) }
+
 // Name returns the metric identifier.
 func (m *Sample) Name() string { return parseMetricName(m.prefix) }
 
+// Name returns the metric identifier.
+func (m *SummarySample) Name() string { return parseMetricName(m.sumPrefix) }
+
+// Name returns the metric identifier.
+func (m *HistogramSample) Name() string { return parseMetricName(m.bucketPrefixes[0]) }
+
 // Name returns the metric identifier.
 func (m *Histogram) Name() string { return parseMetricName(m.bucketPrefixes[0]) }
 
@@ -101,11 +205,20 @@ func (m *Integer) Labels() map[string]string { return parseMetricLabels(m.prefix
 // Labels returns a new map if m has labels.
 func (m *Real) Labels() map[string]string { return parseMetricLabels(m.prefix) }
 
+// Labels returns a new map if m has labels.
+func (m *RealCounter) Labels() map[string]string { return parseMetricLabels(m.prefix) }
+
 // Labels returns a new map if m has labels.
 func (m *Sample) Labels() map[string]string { return parseMetricLabels(m.prefix) }
 
 // Labels returns a new map if m has labels.
-func (m *Histogram) Labels() map[string]string { return parseMetricLabels(m.bucketPrefixes[0]) }
+func (m *SummarySample) Labels() map[string]string { return parseMetricLabels(m.sumPrefix) }
+
+// Labels returns a new map if m has labels.
+func (m *HistogramSample) Labels() map[string]string { return parseMetricLabels(m.sumPrefix) }
+
+// Labels returns a new map if m has labels.
+func (m *Histogram) Labels() map[string]string { return parseMetricLabels(m.sumPrefix) }
 
 // Get returns the current value.
 func (m *Counter) Get() uint64 { return m.value.Load() }
@@ -118,11 +231,25 @@ func (m *Real) Get() float64 {
 	return math.Float64frombits(m.valueBits.Load())
 }
 
+// Get returns the current value.
+func (m *RealCounter) Get() float64 {
+	return math.Float64frombits(m.valueBits.Load())
+}
+
 // Get returns the current value with its Unix time in milliseconds.
 func (m *Sample) Get() (value float64, timestamp uint64) {
-	m.mux.Lock()
-	defer m.mux.Unlock()
-	return m.value, m.timestamp
+	for {
+		seq := m.seq.Load()
+		if seq&1 == 0 {
+			value = math.Float64frombits(m.valueBits.Load())
+			timestamp = m.timestamp.Load()
+			if m.seq.Load() == seq {
+				return value, timestamp
+			}
+		}
+		// lost race with update
+		runtime.Gosched()
+	}
 }
 
 // Set defines the current value.
@@ -142,10 +269,20 @@ func (m *Real) SetSeconds(update time.Duration) {
 
 // Set defines the current value.
 func (m *Sample) Set(value float64, timestamp time.Time) {
-	m.mux.Lock()
-	defer m.mux.Unlock()
-	m.value = value
-	m.timestamp = uint64(timestamp.UnixNano()) / 1e6
+	ms := uint64(timestamp.UnixNano()) / 1e6
+	for {
+		seq := m.seq.Load()
+		// claim with odd sequence number
+		if seq&1 == 0 && m.seq.CompareAndSwap(seq, seq+1) {
+			m.valueBits.Store(math.Float64bits(value))
+			m.timestamp.Store(ms)
+			// release with next even sequence number
+			m.seq.Store(seq + 2)
+			return
+		}
+		// lost race with other update
+		runtime.Gosched()
+	}
 }
 
 // SetSeconds defines the current value.
@@ -153,6 +290,60 @@ func (m *Sample) SetSeconds(value time.Duration, timestamp time.Time) {
 	m.Set(float64(value)/float64(time.Second), timestamp)
 }
 
+// Get appends the value for each SummarySample.Quantiles to a and returns
+// the resulting slice (as values). The count and sum are of the observations
+// in the capture. The timestamp is in Unix time in milliseconds.
+func (m *SummarySample) Get(a []float64) (values []float64, count uint64, sum float64, timestamp uint64) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append(a, m.values...), m.count, m.sum, m.timestamp
+}
+
+// Set defines the current capture. Values are mapped to each
+// SummarySample.Quantiles in order of appearance. Absent values
+// are set to not-a-number (NaN), and any excess values are ignored.
+func (m *SummarySample) Set(values []float64, count uint64, sum float64, timestamp time.Time) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i := range m.values {
+		if i < len(values) {
+			m.values[i] = values[i]
+		} else {
+			m.values[i] = math.NaN()
+		}
+	}
+	m.count = count
+	m.sum = sum
+	m.timestamp = uint64(timestamp.UnixNano()) / 1e6
+}
+
+// Get appends the observation counts for each HistogramSample.BucketBounds to
+// a and returns the resulting slice (as buckets). The count return has the
+// total number of observations, a.k.a. the positive inifinity bucket. The
+// timestamp is in Unix time in milliseconds.
+func (m *HistogramSample) Get(a []uint64) (buckets []uint64, count uint64, sum float64, timestamp uint64) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append(a, m.buckets...), m.count, m.sum, m.timestamp
+}
+
+// Set defines the current capture. Buckets has the observation count for each
+// HistogramSample.BucketBounds (not cumulative), in the same format as the
+// Histogram.Get return. Absent buckets are set to zero, and any excess buckets
+// are ignored. The count includes the positive infinity bucket, i.e., count
+// should be equal to, or greater than the sum of buckets.
+func (m *HistogramSample) Set(buckets []uint64, count uint64, sum float64, timestamp time.Time) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	n := copy(m.buckets, buckets)
+	for i := n; i < len(m.buckets); i++ {
+		m.buckets[i] = 0
+	}
+	m.count = count
+	m.sum = sum
+	m.timestamp = uint64(timestamp.UnixNano()) / 1e6
+}
+
 // Add increments the current value with n.
 func (m *Counter) Add(n uint64) { m.value.Add(n) }
 
@@ -160,6 +351,30 @@ func (m *Counter) Add(n uint64) { m.value.Add(n) }
 // Note that n can be negative (for subtraction).
 func (m *Integer) Add(n int64) { m.value.Add(n) }
 
+// Add increments the current value with n. Add ignores n when negative or
+// not-a-number (NaN), as counters can not decrease.
+func (m *RealCounter) Add(n float64) {
+	if !(n >= 0) {
+		return // not an increment
+	}
+
+	for {
+		oldBits := m.valueBits.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + n)
+		if m.valueBits.CompareAndSwap(oldBits, newBits) {
+			return
+		}
+		// lost race
+		runtime.Gosched()
+	}
+}
+
+// AddSeconds increments the current value with d in seconds. AddSeconds
+// ignores d when negative.
+func (m *RealCounter) AddSeconds(d time.Duration) {
+	m.Add(float64(d) / float64(time.Second))
+}
+
 // Histogram samples observations and counts them in configurable buckets.
 // It also provides a sum of all observed values.
 // Multiple goroutines may invoke methods on a Histogram simultaneously.
@@ -177,15 +392,16 @@ type Histogram struct {
 	// CountAndHotIndex enables lock-free writes with use of atomic updates.
 	// The most significant bit is the hot index [0 or 1] of each hotAndCold
 	// field. Writes update the hot one. All remaining bits count the number
-	// of writes initiated. Write transactions start by incrementing this
-	// counter, and finish by incrementing the hotAndColdCounts field, as a
-	// marker for completion.
+	// of observations initiated. Write transactions start by incrementing
+	// this counter, and finish by incrementing the hotAndColdCounts field
+	// with the same amount, as a marker for completion.
 	//
 	// Reads swap the hot–cold in a switchMutex lock. A cooldown is awaited
 	// (in such lock) by comparing the number of writes with the initiation
 	// count. Once they match, then the last write transaction on the now
 	// cool one completed. All cool fields must be merged into the new hot
-	// before the unlock of switchMutex.
+	// before the next switch. Reads with a time limit may leave the merge
+	// pending for a next read.
 	countAndHotIndex atomic.Uint64
 
 	// counts for each BucketBounds, +Inf omitted
@@ -194,6 +410,8 @@ type Histogram struct {
 	// Upper value for each bucket, sorted, +Inf omitted.
 	// This field is read-only.
 	BucketBounds []float64
+	// bucket index of values
+	search bucketSearch
 
 	// fixed start of each serial line is <name> '{le="' … '"} '
 	bucketPrefixes []string // including +Inf
@@ -204,34 +422,65 @@ type Histogram struct {
 
 	// locked on hotAndCold switch (by reads)
 	switchMutex sync.Mutex
+	// A switch is pending until its cooldown completes. Reads which give
+	// up on the cooldown leave the merge to the next read (in lock).
+	pendingCold     bool
+	pendingHotIndex uint64
+	pendingCount    uint64 // number of writes to cold
+	pendingSwitch   uint64 // switch number
+	pendingStart    int64  // monotonic clock before the switch, if any
+	// number of switches initiated
+	switchCount atomic.Uint64
+
+	// The last completed read is shared without lock. Updates (in the
+	// switchMutex lock) make readSeq odd until done, like with a Sample.
+	readSeq     atomic.Uint64
+	readBuckets []atomic.Uint64 // counts for each BucketBounds
+	readCount   atomic.Uint64
+	readSumBits atomic.Uint64
+	readSwitch  atomic.Uint64 // switch number, or zero for none
+	readStart   atomic.Int64  // monotonic clock before the switch, if any
 }
 
 // Add applies value to the countings.
 func (h *Histogram) Add(value float64) {
 	// define bucket index with padding
-	pi := sort.SearchFloat64s(h.BucketBounds, value) * 16
+	pi := h.search.index(h.BucketBounds, value) * 16
 
-	// start transaction with count increment & resolve hot index [0 or 1]
-	hotIndex := h.countAndHotIndex.Add(1) >> 63
+	hotIndex := h.beginWrite(1)
 
 	// update hot buckets; skips +Inf
 	if buckets := h.hotAndColdBuckets[hotIndex]; pi < len(buckets) {
 		buckets[pi].Add(1)
 	}
 
-	// update hot sum
+	h.endWrite(hotIndex, 1, value)
+}
+
+// BeginWrite starts a transaction for n observations, with a count increment.
+// The return is the hot index [0 or 1] for the bucket updates.
+func (h *Histogram) beginWrite(n uint64) (hotIndex uint64) {
+	return h.countAndHotIndex.Add(n) >> 63
+}
+
+// EndWrite updates the hot sum, and it ends the transaction by matching
+// count(AndHotIndex).
+func (h *Histogram) endWrite(hotIndex, n uint64, sum float64) {
+	addFloatBits(&h.hotAndColdSumBits[hotIndex*16], sum)
+	h.hotAndColdCounts[hotIndex*16].Add(n)
+}
+
+// AddFloatBits sums the float64 bits in p with f.
+func addFloatBits(p *atomic.Uint64, f float64) {
 	for {
-		oldBits := h.hotAndColdSumBits[hotIndex*16].Load()
-		newBits := math.Float64bits(math.Float64frombits(oldBits) + value)
-		if h.hotAndColdSumBits[hotIndex*16].CompareAndSwap(oldBits, newBits) {
-			break
+		oldBits := p.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + f)
+		if p.CompareAndSwap(oldBits, newBits) {
+			return
 		}
 		// lost race
 		runtime.Gosched()
 	}
-
-	// end transaction by matching count(AndHotIndex).
-	h.hotAndColdCounts[hotIndex*16].Add(1)
 }
 
 // AddSince applies the number of seconds since start to the countings.
@@ -243,43 +492,32 @@ func (h *Histogram) AddSince(start time.Time) {
 }
 
 func newHistogram(name string, bucketBounds []float64) *Histogram {
-	// Use copy of bucketBounds to prevent unexpected mutations,
-	// in case the variadic was invoked with a collapsed slice.
-	var a []float64
-	for _, f := range bucketBounds {
-		// skip NaN and ∞
-		if f == f && f <= math.MaxFloat64 {
-			a = append(a, f)
-		}
-	}
-	if len(a) < 2 {
-		bucketBounds = a
-	} else {
-		sort.Float64s(a)
-		bucketBounds = a[:1]
-		for _, f := range a[1:] {
-			if f > bucketBounds[len(bucketBounds)-1] {
-				bucketBounds = append(bucketBounds, f)
-			}
-		}
-	}
+	bucketBounds = bounds.Normalize(bucketBounds)
 
 	// Counters are memory aligned for atomic access.
 	// The 15 64-bit padding entries ensure isolation
 	// with CPU cache lines up to 128 bytes in size.
 	bucketCounts := make([]atomic.Uint64, 2*16*len(bucketBounds))
 
-	h := Histogram{
-		bucketPrefixes: make([]string, len(bucketBounds)+1),
+	return &Histogram{
 		BucketBounds:   bucketBounds,
+		search:         newBucketSearch(bucketBounds),
+		bucketPrefixes: formatBucketPrefixes(name, bucketBounds),
+		countPrefix:    name + "_count ",
+		sumPrefix:      name + "_sum ",
 		hotAndColdBuckets: [2][]atomic.Uint64{
 			bucketCounts[:len(bucketCounts)/2],
 			bucketCounts[len(bucketCounts)/2:],
 		},
+		readBuckets: make([]atomic.Uint64, len(bucketBounds)),
 	}
+}
 
-	// install fixed start of serial lines
-	for i, f := range h.BucketBounds {
+// FormatBucketPrefixes returns the fixed start of each serial line for the
+// buckets, including the positive infinity one, without labels.
+func formatBucketPrefixes(name string, bucketBounds []float64) []string {
+	prefixes := make([]string, len(bucketBounds)+1)
+	for i, f := range bucketBounds {
 		const suffixHead, suffixTail = `{le="`, `"} `
 		var buf strings.Builder
 		buf.Grow(len(name) + len(suffixHead) + maxFloat64Text + len(suffixTail))
@@ -287,44 +525,145 @@ func newHistogram(name string, bucketBounds []float64) *Histogram {
 		buf.WriteString(suffixHead)
 		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
 		buf.WriteString(suffixTail)
-		h.bucketPrefixes[i] = buf.String()
+		prefixes[i] = buf.String()
 	}
-	h.bucketPrefixes[len(h.BucketBounds)] = name + `{le="+Inf"} `
-	h.countPrefix = name + "_count "
-	h.sumPrefix = name + "_sum "
-
-	return &h
+	prefixes[len(bucketBounds)] = name + `{le="+Inf"} `
+	return prefixes
 }
 
 // Get appends the observation counts for each Histogram.BucketBounds to a and
 // returns the resulting slice (as buckets). The count return has the total
-// number of observations, a.k.a. the positive inifinity bucket.
+// number of observations, a.k.a. the positive inifinity bucket. Get waits for
+// any write in progress. Concurrent invocations may share their read.
 func (h *Histogram) Get(a []uint64) (buckets []uint64, count uint64, sum float64) {
-	buckets = a
+	buckets, count, sum, _ = h.GetRecent(a, 0, 0)
+	return
+}
 
-	// see struct comments for algorithm description
-	h.switchMutex.Lock()
-	defer h.switchMutex.Unlock()
+// ErrHistogramStall signals a read which gave up on writes in progress.
+var ErrHistogramStall = errors.New("metrics: histogram read stalled on write in progress")
+
+// GetRecent is like Get, but it may return the result of a previous read, as
+// long as that read started less than maxAge ago. Such reuse needs no lock,
+// which lets multiple readers proceed simultaneously. A positive maxWait limits
+// the time spent waiting on other reads and on writes in progress. GetRecent
+// returns the last completed read with ErrHistogramStall when maxWait expires,
+// which has zero counts when no read completed yet. The interrupted read
+// resumes on the next invocation.
+func (h *Histogram) GetRecent(a []uint64, maxAge, maxWait time.Duration) (buckets []uint64, count uint64, sum float64, err error) {
+	// any switch after entry includes all writes completed before entry
+	entrySwitch := h.switchCount.Load()
+	// clock reads only when needed, as they are relatively expensive
+	var entry int64
+	if maxAge > 0 {
+		entry = monotonicNow()
+	}
+	// reuse of the last completed read
+	tryLast := func() bool {
+		if maxAge <= 0 && h.readSwitch.Load() <= entrySwitch {
+			return false // cheap check
+		}
+		var readSwitch uint64
+		var readStart int64
+		buckets, count, sum, readSwitch, readStart = h.lastRead(a)
+		return readSwitch > entrySwitch || maxAge > 0 && readStart != 0 && readStart > entry-int64(maxAge)
+	}
 
-	// Adding 1<<63 swaps the index of hotAndCold from 0 to 1,
-	// or from 1 to 0, without touching the initiation counter.
-	updated := h.countAndHotIndex.Add(1 << 63)
+	if tryLast() {
+		return
+	}
 
-	// write destination after switch
-	hotIndex := updated >> 63
-	coldIndex := hotIndex ^ 1
+	if maxWait > 0 {
+		deadline := time.Now().Add(maxWait)
+		for !h.switchMutex.TryLock() {
+			if tryLast() {
+				return
+			}
+			if time.Now().After(deadline) {
+				buckets, count, sum, _, _ = h.lastRead(a)
+				return buckets, count, sum, ErrHistogramStall
+			}
+			runtime.Gosched()
+		}
+		defer h.switchMutex.Unlock()
+
+		// read by others while waiting on the lock
+		if tryLast() {
+			return
+		}
+		if !h.cooldownAndMerge(entry, deadline) {
+			buckets, count, sum, _, _ = h.lastRead(a)
+			return buckets, count, sum, ErrHistogramStall
+		}
+	} else {
+		h.switchMutex.Lock()
+		defer h.switchMutex.Unlock()
+
+		// read by others while waiting on the lock
+		if tryLast() {
+			return
+		}
+		h.cooldownAndMerge(entry, time.Time{})
+	}
+	buckets, count, sum, _, _ = h.lastRead(a)
+	return
+}
 
-	// number of writes to cold
-	count = updated &^ (1 << 63)
+// CooldownAndMerge completes any pending switch first. A read which is not
+// recent enough (after the resume) gets a new switch. A zero start time means
+// unknown. It returns false when the deadline passed before completion. A zero
+// deadline waits indefinitely. The caller must hold switchMutex.
+func (h *Histogram) cooldownAndMerge(start int64, deadline time.Time) bool {
+	for {
+		// see struct comments for algorithm description
+		resumed := h.pendingCold
+		if !resumed {
+			h.pendingStart = start
+			h.pendingSwitch = h.switchCount.Add(1)
+
+			// Adding 1<<63 swaps the index of hotAndCold from 0 to 1,
+			// or from 1 to 0, without touching the initiation counter.
+			updated := h.countAndHotIndex.Add(1 << 63)
+
+			// write destination after switch
+			h.pendingCold = true
+			h.pendingHotIndex = updated >> 63
+			// number of writes to cold
+			h.pendingCount = updated &^ (1 << 63)
+		}
 
-	// cooldown: await initiated writes to complete
-	for count > h.hotAndColdCounts[coldIndex*16].Load() {
-		runtime.Gosched()
+		// cooldown: await initiated writes to complete
+		coldIndex := h.pendingHotIndex ^ 1
+		for h.pendingCount > h.hotAndColdCounts[coldIndex*16].Load() {
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				return false
+			}
+			runtime.Gosched()
+		}
+
+		h.mergeCold()
+		if !resumed {
+			return true
+		}
+		// The resumed read may satisfy the invoker already. A
+		// new switch is simpler than to make such distinction.
 	}
+}
+
+// MergeCold moves all countings from the cold index into the hot index, and it
+// publishes the result as the last completed read. The caller must hold
+// switchMutex, with the cooldown completed.
+func (h *Histogram) mergeCold() {
+	hotIndex := h.pendingHotIndex
+	coldIndex := hotIndex ^ 1
+
+	// odd sequence for the update of the last read
+	h.readSeq.Add(1)
 
 	// merge count into hot and reset cold to zero
 	h.hotAndColdCounts[coldIndex*16].Store(0)
-	h.hotAndColdCounts[hotIndex*16].Add(count)
+	h.hotAndColdCounts[hotIndex*16].Add(h.pendingCount)
+	h.readCount.Store(h.pendingCount)
 
 	// merge buckets into hot and reset cold to zero
 	hotBuckets := h.hotAndColdBuckets[hotIndex]
@@ -334,21 +673,52 @@ func (h *Histogram) Get(a []uint64) (buckets []uint64, count uint64, sum float64
 		coldBuckets[i].Store(0)
 		hotBuckets[i].Add(n)
 
-		buckets = append(buckets, n)
+		h.readBuckets[i/16].Store(n)
 	}
 
 	// merge sum into hot and reset cold to zero
-	sum = math.Float64frombits(h.hotAndColdSumBits[coldIndex*16].Load())
+	sumBits := h.hotAndColdSumBits[coldIndex*16].Load()
 	h.hotAndColdSumBits[coldIndex*16].Store(0)
+	addFloatBits(&h.hotAndColdSumBits[hotIndex*16], math.Float64frombits(sumBits))
+	h.readSumBits.Store(sumBits)
+
+	h.readSwitch.Store(h.pendingSwitch)
+	h.readStart.Store(h.pendingStart)
+	h.pendingCold = false
+
+	// even sequence for the update of the last read
+	h.readSeq.Add(1)
+}
+
+// LastRead appends the last completed read to a, with zero counts when none.
+func (h *Histogram) lastRead(a []uint64) (buckets []uint64, count uint64, sum float64, switchNo uint64, start int64) {
 	for {
-		oldBits := h.hotAndColdSumBits[hotIndex*16].Load()
-		newBits := math.Float64bits(math.Float64frombits(oldBits) + sum)
-		if h.hotAndColdSumBits[hotIndex*16].CompareAndSwap(oldBits, newBits) {
-			break
+		seq := h.readSeq.Load()
+		if seq&1 != 0 {
+			// update in progress
+			runtime.Gosched()
+			continue
+		}
+
+		buckets = a
+		for i := range h.readBuckets {
+			buckets = append(buckets, h.readBuckets[i].Load())
+		}
+		count = h.readCount.Load()
+		sum = math.Float64frombits(h.readSumBits.Load())
+		switchNo = h.readSwitch.Load()
+		start = h.readStart.Load()
+
+		if h.readSeq.Load() == seq {
+			return
 		}
-		// lost race
-		runtime.Gosched()
 	}
+}
 
-	return
+// MonotonicEpoch is the reference for monotonicNow.
+var monotonicEpoch = time.Now()
+
+// MonotonicNow returns a positive reading of the monotonic clock.
+func monotonicNow() int64 {
+	return int64(time.Since(monotonicEpoch)) + 1
 }
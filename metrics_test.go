@@ -2,13 +2,16 @@ package metrics_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -40,6 +43,13 @@ func TestName(t *testing.T) {
 		t.Errorf(`labeled real got %q, want "lr"`, got)
 	}
 
+	if got := reg.MustRealCounter("rc", "").Name(); got != "rc" {
+		t.Errorf(`real counter got %q, want "rc"`, got)
+	}
+	if got := reg.Must2LabelRealCounter("lrc", "l1", "l2")("v1", "v2").Name(); got != "lrc" {
+		t.Errorf(`labeled real counter got %q, want "lrc"`, got)
+	}
+
 	if got := reg.MustCounterSample("cs", "").Name(); got != "cs" {
 		t.Errorf(`counter sample got %q, want "cs"`, got)
 	}
@@ -169,6 +179,104 @@ func ExampleHistogram() {
 	// http_latency_seconds_sum{method="OPTIONS",status="2xx"} 9e-06
 }
 
+func ExampleSummarySample() {
+	// setup
+	demo := metrics.NewRegister()
+	Latency := demo.MustSummarySample("rpc_latency_seconds", "Round-trip time as reported by the server.", 0.5, 0.9, 0.99)
+
+	// capture
+	Latency.Set([]float64{0.012, 0.034, 0.125}, 1024, 18.432, time.UnixMilli(1615130567389))
+
+	// print
+	metrics.SkipTimestamp = false
+	demo.WriteTo(os.Stdout)
+	// Output:
+	// # Prometheus Samples
+	//
+	// # TYPE rpc_latency_seconds summary
+	// # HELP rpc_latency_seconds Round-trip time as reported by the server.
+	// rpc_latency_seconds{quantile="0.5"} 0.012 1615130567389
+	// rpc_latency_seconds{quantile="0.9"} 0.034 1615130567389
+	// rpc_latency_seconds{quantile="0.99"} 0.125 1615130567389
+	// rpc_latency_seconds_sum 18.432 1615130567389
+	// rpc_latency_seconds_count 1024 1615130567389
+}
+
+func ExampleHistogramSample() {
+	// setup
+	demo := metrics.NewRegister()
+	QueryTime := demo.Must1LabelHistogramSample("db_query_seconds", "table", 0.01, 0.1, 1)
+	demo.MustHelp("db_query_seconds", "Execution time as reported by the database.")
+
+	// capture
+	QueryTime("user").Set([]uint64{52, 7, 1}, 61, 1.875, time.UnixMilli(1615130567389))
+
+	// print
+	metrics.SkipTimestamp = false
+	demo.WriteTo(os.Stdout)
+	// Output:
+	// # Prometheus Samples
+	//
+	// # TYPE db_query_seconds histogram
+	// # HELP db_query_seconds Execution time as reported by the database.
+	// db_query_seconds_count{table="user"} 61 1615130567389
+	// db_query_seconds{le="0.01",table="user"} 52 1615130567389
+	// db_query_seconds{le="0.1",table="user"} 59 1615130567389
+	// db_query_seconds{le="1",table="user"} 60 1615130567389
+	// db_query_seconds{le="+Inf",table="user"} 61 1615130567389
+	// db_query_seconds_sum{table="user"} 1.875 1615130567389
+}
+
+func TestHistogramSample(t *testing.T) {
+	reg := metrics.NewRegister()
+	h := reg.MustHistogramSample("h", "", 4, 1, 2, math.NaN())
+	if want := []float64{1, 2, 4}; !reflect.DeepEqual(h.BucketBounds, want) {
+		t.Errorf("got bucket bounds %v, want %v", h.BucketBounds, want)
+	}
+
+	h.Set([]uint64{1, 2, 3, 4}, 11, 9.5, time.Now())
+	h.Set([]uint64{5}, 6, 0.5, time.Now())
+	buckets, count, sum, timestamp := h.Get(nil)
+	if want := []uint64{5, 0, 0}; !reflect.DeepEqual(buckets, want) {
+		t.Errorf("got buckets %v, want %v", buckets, want)
+	}
+	if count != 6 || sum != 0.5 || timestamp == 0 {
+		t.Errorf("got count %d, sum %g and timestamp %d, want 6, 0.5 and non-zero", count, sum, timestamp)
+	}
+
+	// no serial without capture
+	reg.Must2LabelHistogramSample("lh", "b", "a", 1)("1", "2")
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	if strings.Contains(buf.String(), "lh_count") {
+		t.Errorf("got serial of histogram sample without capture: %q", buf.String())
+	}
+}
+
+func TestSummarySampleQuantiles(t *testing.T) {
+	reg := metrics.NewRegister()
+	for _, quantiles := range [][]float64{{-0.1}, {1.5}, {math.NaN()}, {0.5, 0.25}, {0.5, 0.5}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for quantiles %v", quantiles)
+				}
+			}()
+			reg.MustSummarySample("s", "", quantiles...)
+		}()
+	}
+
+	s := reg.MustSummarySample("s", "", 0, 0.5, 1)
+	s.Set([]float64{1, 2}, 2, 3, time.Now())
+	values, count, sum, timestamp := s.Get(nil)
+	if len(values) != 3 || values[0] != 1 || values[1] != 2 || !math.IsNaN(values[2]) {
+		t.Errorf("got values %v, want [1 2 NaN]", values)
+	}
+	if count != 2 || sum != 3 || timestamp == 0 {
+		t.Errorf("got count %d, sum %g and timestamp %d, want 2, 3 and non-zero", count, sum, timestamp)
+	}
+}
+
 func TestHistogramBuckets(t *testing.T) {
 	reg := metrics.NewRegister()
 
@@ -190,6 +298,135 @@ func TestHistogramBuckets(t *testing.T) {
 	}
 }
 
+func TestHistogramBucketSearch(t *testing.T) {
+	var linear, linearFraction, exponential, exponentialFraction, irregular []float64
+	for i := 0; i < 50; i++ {
+		linear = append(linear, float64(i*10-100))
+		linearFraction = append(linearFraction, 0.1*float64(i+1))
+		exponential = append(exponential, math.Ldexp(1, i-25))
+		exponentialFraction = append(exponentialFraction, 0.001*math.Pow(1.5, float64(i)))
+		irregular = append(irregular, float64(i*i)/3)
+	}
+	layouts := map[string][]float64{
+		"small":                {-1, 0, 0.25, 1, 2, 5, 1e9},
+		"linear":               linear,
+		"linear-fraction":      linearFraction[:20],
+		"exponential":          exponential,
+		"exponential-fraction": exponentialFraction,
+		"irregular":            irregular,
+	}
+
+	for name, bounds := range layouts {
+		values := []float64{math.NaN(), math.Inf(1), math.Inf(-1), 0, math.Copysign(0, -1),
+			math.MaxFloat64, -math.MaxFloat64, math.SmallestNonzeroFloat64}
+		for _, f := range bounds {
+			values = append(values, f, math.Nextafter(f, math.Inf(1)), math.Nextafter(f, math.Inf(-1)), f*1.01, f*0.99)
+		}
+
+		for _, v := range values {
+			h := metrics.NewRegister().MustHistogram("h", "", bounds...)
+			h.Add(v)
+			buckets, _, _ := h.Get(nil)
+			// +Inf when no match
+			var got int
+			for got < len(buckets) && buckets[got] == 0 {
+				got++
+			}
+			if want := sort.SearchFloat64s(h.BucketBounds, v); got != want {
+				t.Errorf("%s: value %g got bucket %d, want %d", name, v, got, want)
+			}
+		}
+	}
+}
+
+func TestSampleConsistency(t *testing.T) {
+	s := metrics.NewRegister().MustRealSample("s", "")
+
+	const writes = 10000
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(offset int64) {
+			defer wg.Done()
+			for i := int64(1); i <= writes; i++ {
+				ms := i*2 + offset
+				s.Set(float64(ms), time.UnixMilli(ms))
+			}
+		}(int64(w))
+	}
+
+	stop := make(chan struct{})
+	readErrs := make(chan string, 2)
+	for r := 0; r < 2; r++ {
+		go func() {
+			for {
+				select {
+				case <-stop:
+					readErrs <- ""
+					return
+				default:
+					value, timestamp := s.Get()
+					if value != float64(timestamp) {
+						readErrs <- fmt.Sprintf("got value %g with timestamp %d", value, timestamp)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stop)
+	for r := 0; r < 2; r++ {
+		if msg := <-readErrs; msg != "" {
+			t.Error(msg)
+		}
+	}
+}
+
+func TestRealCounter(t *testing.T) {
+	metrics.SkipTimestamp = true
+	reg := metrics.NewRegister()
+	c := reg.MustRealCounter("cpu_seconds_total", "")
+	c.Add(0.25)
+	c.AddSeconds(1500 * time.Millisecond)
+	reg.Must2LabelRealCounter("bytes_total", "dir", "device")("in", "sda").Add(0.5)
+
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 1000; j++ {
+				c.Add(1)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	if got := c.Get(); got != 4001.75 {
+		t.Errorf("got %g, want 4001.75", got)
+	}
+
+	c.Add(-1)
+	c.Add(math.NaN())
+	c.AddSeconds(-time.Second)
+
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	const want = `# Prometheus Samples
+
+# TYPE cpu_seconds_total counter
+cpu_seconds_total 4001.75
+
+# TYPE bytes_total counter
+bytes_total{device="sda",dir="in"} 0.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func BenchmarkGet(b *testing.B) {
 	b.Run("histogram5", func(b *testing.B) {
 		h := metrics.NewRegister().MustHistogram("bench_histogram_unit", "", .01, .02, .05, .1)
@@ -215,6 +452,38 @@ func BenchmarkGet(b *testing.B) {
 			<-done
 			<-done
 		})
+
+		b.Run("recent", func(b *testing.B) {
+			var buckets []uint64
+			for i := 0; i < b.N; i++ {
+				buckets, _, _, _ = h.GetRecent(buckets[:0], time.Second, time.Second)
+			}
+		})
+	})
+
+	b.Run("sample", func(b *testing.B) {
+		m := metrics.NewRegister().MustRealSample("bench_sample_unit", "")
+		m.Set(42, time.Now())
+
+		b.Run("sequential", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.Get()
+			}
+		})
+
+		b.Run("2routines", func(b *testing.B) {
+			done := make(chan struct{})
+			f := func() {
+				for i := b.N / 2; i >= 0; i-- {
+					m.Get()
+				}
+				done <- struct{}{}
+			}
+			go f()
+			go f()
+			<-done
+			<-done
+		})
 	})
 }
 
@@ -314,6 +583,29 @@ func BenchmarkAdd(b *testing.B) {
 		})
 	})
 
+	b.Run("real-counter", func(b *testing.B) {
+		m := metrics.NewRegister().MustRealCounter("bench_real_counter_unit", "")
+
+		b.Run("sequential", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.Add(1)
+			}
+		})
+		b.Run("2routines", func(b *testing.B) {
+			done := make(chan struct{})
+			f := func() {
+				for i := b.N / 2; i >= 0; i-- {
+					m.Add(1)
+				}
+				done <- struct{}{}
+			}
+			go f()
+			go f()
+			<-done
+			<-done
+		})
+	})
+
 	b.Run("histogram5", func(b *testing.B) {
 		h := metrics.NewRegister().MustHistogram("bench_histogram_unit", "", 1, 2, 5, 6)
 
@@ -336,4 +628,110 @@ func BenchmarkAdd(b *testing.B) {
 			<-done
 		})
 	})
+
+	var linear20, exponential50, irregular50 []float64
+	for i := 0; i < 50; i++ {
+		if i < 20 {
+			linear20 = append(linear20, 0.05*float64(i+1))
+		}
+		exponential50 = append(exponential50, 1e-6*math.Pow(1.4, float64(i)))
+		irregular50 = append(irregular50, float64(i*i)/1e3)
+	}
+	// observations spread over the buckets
+	values := make([]float64, 64)
+	for i := range values {
+		values[i] = math.Pow(10, float64(i)/8-5)
+	}
+	for _, layout := range []struct {
+		name   string
+		bounds []float64
+	}{
+		{"histogram20-linear", linear20},
+		{"histogram50-exponential", exponential50},
+		{"histogram50-irregular", irregular50},
+	} {
+		b.Run(layout.name, func(b *testing.B) {
+			h := metrics.NewRegister().MustHistogram("bench_histogram_unit", "", layout.bounds...)
+
+			b.Run("sequential", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					h.Add(values[i&63])
+				}
+			})
+			b.Run("2routines", func(b *testing.B) {
+				done := make(chan struct{})
+				f := func() {
+					for i := b.N / 2; i >= 0; i-- {
+						h.Add(values[i&63])
+					}
+					done <- struct{}{}
+				}
+				go f()
+				go f()
+				<-done
+				<-done
+			})
+		})
+	}
+}
+
+func TestHistogramConcurrentReads(t *testing.T) {
+	h := metrics.NewRegister().MustHistogram("h", "", 0.5, 1.5)
+
+	const writers, readers, writes = 4, 4, 2000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				h.Add(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var readWG sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		readWG.Add(1)
+		go func(r int) {
+			defer readWG.Done()
+			maxAge := time.Duration(r) * time.Millisecond
+			var last uint64
+			var buckets []uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				var count uint64
+				var sum float64
+				var err error
+				buckets, count, sum, err = h.GetRecent(buckets[:0], maxAge, time.Millisecond)
+				if err != nil && err != metrics.ErrHistogramStall {
+					t.Error("read error:", err)
+					return
+				}
+				if len(buckets) != 2 || buckets[0] != 0 || buckets[1] != count || sum != float64(count) {
+					t.Errorf("inconsistent read: buckets %d, count %d, sum %g", buckets, count, sum)
+					return
+				}
+				if count < last {
+					t.Errorf("count %d after %d", count, last)
+					return
+				}
+				last = count
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	close(done)
+	readWG.Wait()
+
+	if _, count, _ := h.Get(nil); count != writers*writes {
+		t.Errorf("got count %d, want %d", count, writers*writes)
+	}
 }
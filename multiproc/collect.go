@@ -0,0 +1,448 @@
+//go:build unix
+
+package multiproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pascaldekloe/metrics"
+	"github.com/pascaldekloe/metrics/internal/bounds"
+)
+
+// Collector merges the files of all processes into a Register. Counters
+// become counter samples, Integers become gauge samples, and Histograms become
+// histogram samples, all with the capture time as the timestamp. Multiple
+// goroutines may invoke methods on a Collector simultaneously.
+type Collector struct {
+	// Help has optional comment texts per metric name, applied on
+	// registration.
+	Help map[string]string
+
+	reg *metrics.Register
+	dir string
+
+	mutex sync.Mutex
+	// registered names with their kind
+	kinds map[string]uint8
+	// label functions per name plus label names
+	labelFuncs map[string]any
+	// registrations per key
+	samples          map[string]*metrics.Sample
+	histogramSamples map[string]*metrics.HistogramSample
+}
+
+// NewCollector returns a new Collector for the files in directory dir.
+// Registration on reg happens on Capture, when metrics are first seen.
+func NewCollector(reg *metrics.Register, dir string) *Collector {
+	return &Collector{
+		reg:              reg,
+		dir:              dir,
+		kinds:            make(map[string]uint8),
+		labelFuncs:       make(map[string]any),
+		samples:          make(map[string]*metrics.Sample),
+		histogramSamples: make(map[string]*metrics.HistogramSample),
+	}
+}
+
+// Merge is the aggregation in progress of a key.
+type merge struct {
+	key    string
+	kind   uint8
+	agg    Aggregation
+	bounds []float64
+
+	count   uint64 // counter value or histogram total
+	value   int64  // integer value
+	n       int    // number of integer values
+	buckets []uint64
+	sum     float64
+
+	err error // conflict
+}
+
+// Entry is a reading from a file.
+type entry struct {
+	key    string
+	kind   uint8
+	agg    Aggregation
+	bounds []float64
+	slots  []uint64
+}
+
+// Capture updates the metrics with a merge of each file. Files which fail to
+// read are omitted. So are metrics with a name in use as another kind, and
+// histograms with conflicting bucket bounds. The error return has the first
+// such issue, if any.
+func (c *Collector) Capture() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+FileExt))
+	if err != nil {
+		return fmt.Errorf("multiproc: %w", err)
+	}
+
+	var firstErr error
+	var order []*merge // first appearance
+	merges := make(map[string]*merge)
+	for _, path := range paths {
+		entries, live, err := readFile(path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		for _, e := range entries {
+			m, ok := merges[e.key]
+			if !ok {
+				m = &merge{key: e.key, kind: e.kind, agg: e.agg, bounds: e.bounds}
+				if e.kind == histogramKind {
+					m.buckets = make([]uint64, len(e.bounds))
+				}
+				merges[e.key] = m
+				order = append(order, m)
+			}
+			if m.err != nil {
+				continue
+			}
+			if m.kind != e.kind || m.agg != e.agg || !bounds.Equal(m.bounds, e.bounds) {
+				m.err = fmt.Errorf("multiproc: metric %q from %s conflicts with other processes", keyName(e.key), path)
+				continue
+			}
+			m.add(e, live)
+		}
+	}
+
+	now := time.Now()
+	for _, m := range order {
+		err := m.err
+		if err == nil {
+			err = c.apply(m, now)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *merge) add(e entry, live bool) {
+	switch e.kind {
+	case counterKind:
+		m.count += e.slots[0]
+	case integerKind:
+		if m.agg&LiveOnly != 0 && !live {
+			return
+		}
+		v := int64(e.slots[0])
+		switch {
+		case m.n == 0, m.agg&^LiveOnly == Sum:
+			m.value += v
+		case m.agg&^LiveOnly == Min && v < m.value, m.agg&^LiveOnly == Max && v > m.value:
+			m.value = v
+		}
+		m.n++
+	case histogramKind:
+		for i, n := range e.slots[:len(e.slots)-1] {
+			if i < len(m.buckets) {
+				m.buckets[i] += n
+			}
+			m.count += n
+		}
+		m.sum += math.Float64frombits(e.slots[len(e.slots)-1])
+	}
+}
+
+// Apply sets the merge on its registration.
+func (c *Collector) apply(m *merge, now time.Time) error {
+	switch m.kind {
+	case counterKind:
+		s, err := c.sample(m.key, counterKind)
+		if err != nil {
+			return err
+		}
+		s.Set(float64(m.count), now)
+	case integerKind:
+		s, err := c.sample(m.key, integerKind)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.n != 0:
+			s.Set(float64(m.value), now)
+		case m.agg&^LiveOnly == Sum:
+			s.Set(0, now)
+		default:
+			// no minimum or maximum without processes
+			s.Set(math.NaN(), now)
+		}
+	case histogramKind:
+		s, err := c.histogramSample(m.key, m.bounds)
+		if err != nil {
+			return err
+		}
+		s.Set(m.buckets, m.count, m.sum, now)
+	}
+	return nil
+}
+
+// Sample returns the registration of a counter or integer key.
+func (c *Collector) sample(key string, kind uint8) (*metrics.Sample, error) {
+	if s, ok := c.samples[key]; ok {
+		return s, nil
+	}
+	name, labelNames, labelValues, err := c.claimKind(key, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var s *metrics.Sample
+	if kind == counterKind {
+		switch len(labelNames) {
+		case 0:
+			s = c.reg.MustCounterSample(name, c.Help[name])
+		case 1:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must1LabelCounterSample(name, labelNames[0])
+			}).(func(string) *metrics.Sample)
+			s = f(labelValues[0])
+		case 2:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must2LabelCounterSample(name, labelNames[0], labelNames[1])
+			}).(func(string, string) *metrics.Sample)
+			s = f(labelValues[0], labelValues[1])
+		default:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must3LabelCounterSample(name, labelNames[0], labelNames[1], labelNames[2])
+			}).(func(string, string, string) *metrics.Sample)
+			s = f(labelValues[0], labelValues[1], labelValues[2])
+		}
+	} else {
+		switch len(labelNames) {
+		case 0:
+			s = c.reg.MustRealSample(name, c.Help[name])
+		case 1:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must1LabelRealSample(name, labelNames[0])
+			}).(func(string) *metrics.Sample)
+			s = f(labelValues[0])
+		case 2:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must2LabelRealSample(name, labelNames[0], labelNames[1])
+			}).(func(string, string) *metrics.Sample)
+			s = f(labelValues[0], labelValues[1])
+		default:
+			f := c.labelFunc(name, labelNames, func() any {
+				return c.reg.Must3LabelRealSample(name, labelNames[0], labelNames[1], labelNames[2])
+			}).(func(string, string, string) *metrics.Sample)
+			s = f(labelValues[0], labelValues[1], labelValues[2])
+		}
+	}
+	c.samples[key] = s
+	return s, nil
+}
+
+// HistogramSample returns the registration of a histogram key.
+func (c *Collector) histogramSample(key string, bucketBounds []float64) (*metrics.HistogramSample, error) {
+	if s, ok := c.histogramSamples[key]; ok {
+		if !bounds.Equal(s.BucketBounds, bucketBounds) {
+			return nil, fmt.Errorf("multiproc: histogram %q in use with other bucket bounds", keyName(key))
+		}
+		return s, nil
+	}
+	name, labelNames, labelValues, err := c.claimKind(key, histogramKind)
+	if err != nil {
+		return nil, err
+	}
+
+	var s *metrics.HistogramSample
+	switch len(labelNames) {
+	case 0:
+		s = c.reg.MustHistogramSample(name, c.Help[name], bucketBounds...)
+	case 1:
+		f := c.labelFunc(name, labelNames, func() any {
+			return c.reg.Must1LabelHistogramSample(name, labelNames[0], bucketBounds...)
+		}).(func(string) *metrics.HistogramSample)
+		s = f(labelValues[0])
+	default:
+		f := c.labelFunc(name, labelNames, func() any {
+			return c.reg.Must2LabelHistogramSample(name, labelNames[0], labelNames[1], bucketBounds...)
+		}).(func(string, string) *metrics.HistogramSample)
+		s = f(labelValues[0], labelValues[1])
+	}
+	if !bounds.Equal(s.BucketBounds, bucketBounds) {
+		return nil, fmt.Errorf("multiproc: histogram %q in use with other bucket bounds", name)
+	}
+	c.histogramSamples[key] = s
+	return s, nil
+}
+
+// ClaimKind parses key, and it claims the name for kind.
+func (c *Collector) claimKind(key string, kind uint8) (name string, labelNames, labelValues []string, err error) {
+	name, labelNames, labelValues, err = parseKey(key)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("multiproc: %w", err)
+	}
+	if k, ok := c.kinds[name]; ok && k != kind {
+		return "", nil, nil, fmt.Errorf("multiproc: metric %q in use as another kind", name)
+	}
+	c.kinds[name] = kind
+	return name, labelNames, labelValues, nil
+}
+
+// LabelFunc returns the label function of name with labelNames, with
+// registration by create on absence.
+func (c *Collector) labelFunc(name string, labelNames []string, create func() any) any {
+	funcKey := name
+	for _, s := range labelNames {
+		funcKey += "\x00" + s
+	}
+	f, ok := c.labelFuncs[funcKey]
+	if !ok {
+		f = create()
+		c.labelFuncs[funcKey] = f
+		if help, ok := c.Help[name]; ok {
+			c.reg.MustHelp(name, help)
+		}
+	}
+	return f
+}
+
+// CaptureEvery updates the metrics with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel.
+func (c *Collector) CaptureEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		c.Capture()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				c.Capture()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func keyName(key string) string {
+	name, _, _, err := parseKey(key)
+	if err != nil {
+		return "?"
+	}
+	return name
+}
+
+// ReadFile returns a copy of all entries in the file at path, and whether the
+// process is live.
+func readFile(path string) (entries []entry, live bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("multiproc: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, fmt.Errorf("multiproc: %w", err)
+	}
+	if info.Size() < headerSize {
+		return nil, false, nil // in creation
+	}
+	b, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false, fmt.Errorf("multiproc: %s mapping: %w", path, err)
+	}
+	defer syscall.Munmap(b)
+
+	corrupt := func(reason string) error {
+		return fmt.Errorf("multiproc: %s: %w", path, errors.New(reason))
+	}
+	if string(b[:len(fileMagic)]) != fileMagic {
+		return nil, false, corrupt("no file header")
+	}
+	if v := binary.LittleEndian.Uint16(b[4:]); v != fileVersion {
+		return nil, false, corrupt(fmt.Sprintf("unsupported version %d", v))
+	}
+	pid := int(binary.LittleEndian.Uint64(b[8:]))
+	used := int(loadSlot(b, usedOffset))
+	if used < headerSize || used > len(b) {
+		return nil, false, corrupt("used size out of bounds")
+	}
+	live = loadSlot(b, closedOffset) == 0 && processLive(pid)
+
+	for offset := headerSize; offset < used; {
+		size := int(binary.LittleEndian.Uint32(b[offset:]))
+		if size == 0 {
+			// skip to next segment
+			offset = (offset/segmentSize + 1) * segmentSize
+			continue
+		}
+		if size < 16 || size%8 != 0 || offset+size > used {
+			return nil, false, corrupt("entry size out of bounds")
+		}
+		p := b[offset : offset+size]
+		offset += size
+
+		e := entry{kind: p[4], agg: Aggregation(p[5])}
+		boundCount := int(binary.LittleEndian.Uint16(p[6:]))
+		keySize := int(binary.LittleEndian.Uint16(p[8:]))
+		boundsOffset := (10 + keySize + 7) &^ 7
+		slotsOffset := boundsOffset + boundCount*8
+		slotCount := (size - slotsOffset) / 8
+		switch {
+		case slotsOffset > size:
+			return nil, false, corrupt("entry content exceeds size")
+		case e.kind == counterKind || e.kind == integerKind:
+			if slotCount != 1 {
+				return nil, false, corrupt("entry size mismatch")
+			}
+		case e.kind == histogramKind:
+			if slotCount != boundCount+2 {
+				return nil, false, corrupt("entry size mismatch")
+			}
+		default:
+			return nil, false, corrupt(fmt.Sprintf("unknown entry kind %d", e.kind))
+		}
+
+		e.key = string(p[10 : 10+keySize])
+		for i := 0; i < boundCount; i++ {
+			e.bounds = append(e.bounds, math.Float64frombits(binary.LittleEndian.Uint64(p[boundsOffset+i*8:])))
+		}
+		e.slots = make([]uint64, slotCount)
+		for i := range e.slots {
+			e.slots[i] = loadSlot(p, slotsOffset+i*8)
+		}
+		entries = append(entries, e)
+	}
+	return entries, live, nil
+}
+
+func loadSlot(b []byte, offset int) uint64 {
+	return (*atomic.Uint64)(unsafe.Pointer(&b[offset])).Load()
+}
+
+// ProcessLive returns whether a process with pid exists. Any process with a
+// reused pid counts as such.
+func processLive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
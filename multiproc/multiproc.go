@@ -0,0 +1,448 @@
+//go:build unix
+
+// Package multiproc shares metrics across processes, for pre-forked workers in
+// particular. Each worker process records its Counter, Integer and Histogram
+// values in a memory-mapped file of its own, with Create. A Collector in the
+// parent process merges the files of all workers into a metrics.Register.
+//
+// The files are specific to the platform, as values are stored in the native
+// byte order. They should reside on a memory-backed file system, such as
+// /dev/shm or tmpfs, for performance.
+package multiproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pascaldekloe/metrics/internal/bounds"
+)
+
+// FileExt is the name extension of the per-process files.
+const FileExt = ".metrics"
+
+// File layout (version 1) starts with a header of headerSize bytes:
+//
+//	magic "MTMP" | version uint16 | reserved uint16 | pid uint64 | used uint64 | closed uint64
+//
+// The used field has the number of bytes in use, entries included. Entries
+// follow the header, each starting at an 8-byte boundary:
+//
+//	size uint32 | kind uint8 | aggregation uint8 | bound count uint16 | key size uint16 | key … | padding
+//	bounds float64 … | slots uint64 …
+//
+// An entry never crosses the end of a mapping. A zero size marks the unused
+// remainder of a mapping, i.e., the next entry starts at the next segment.
+// Counters and Integers have one slot. Histograms have a slot for each bucket,
+// +Inf included, followed by a slot with the float64 bits of the sum.
+const (
+	fileMagic   = "MTMP"
+	fileVersion = 1
+
+	headerSize   = 64
+	usedOffset   = 16
+	closedOffset = 24
+)
+
+const (
+	counterKind = iota + 1
+	integerKind
+	histogramKind
+)
+
+// SegmentSize is the unit of file growth. Mappings must start at a page
+// boundary.
+var segmentSize = 64 * 1024
+
+func init() {
+	if n := os.Getpagesize(); n > segmentSize {
+		segmentSize = n
+	}
+}
+
+// Aggregation defines how the values of an Integer from multiple processes
+// are merged into one. Counters and Histograms are always summed.
+type Aggregation uint8
+
+// Aggregation options can be combined with LiveOnly, e.g., Max|LiveOnly.
+const (
+	Sum Aggregation = iota // total of all processes
+	Min                    // lowest of all processes
+	Max                    // highest of all processes
+
+	// LiveOnly excludes processes which terminated, or which closed their
+	// File. Values from processes which terminated are included otherwise.
+	// Processes are identified by their ID, which the operating system may
+	// reuse. The file of a process which terminated without Close counts as
+	// live while another process runs with the same ID.
+	LiveOnly Aggregation = 1 << 7
+)
+
+// File holds the metrics of a process. Multiple goroutines may invoke methods
+// on a File simultaneously.
+type File struct {
+	f *os.File
+
+	mutex sync.Mutex
+	// first mapping with the header
+	header []byte
+	// last mapping with its file offset
+	mapping       []byte
+	mappingOffset int
+	// file size
+	end int
+	// write offset, as in the header
+	used int
+
+	// instances by key
+	counters   map[string]*Counter
+	integers   map[string]*Integer
+	histograms map[string]*Histogram
+}
+
+// Create starts a new file for the current process in directory dir. File
+// names consist of the process ID and the creation time, such that files from
+// previous processes with the same process ID remain in the totals.
+func Create(dir string) (*File, error) {
+	return create(dir, os.Getpid())
+}
+
+func create(dir string, pid int) (*File, error) {
+	var path string
+	var f *os.File
+	for t := time.Now().UnixNano(); ; t++ {
+		path = filepath.Join(dir, strconv.Itoa(pid)+"-"+strconv.FormatInt(t, 10)+FileExt)
+		var err error
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+	}
+	file := &File{
+		f:          f,
+		counters:   make(map[string]*Counter),
+		integers:   make(map[string]*Integer),
+		histograms: make(map[string]*Histogram),
+	}
+	if err := file.grow(headerSize); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	file.header = file.mapping
+	copy(file.header, fileMagic)
+	binary.LittleEndian.PutUint16(file.header[4:], fileVersion)
+	binary.LittleEndian.PutUint64(file.header[8:], uint64(pid))
+	file.used = headerSize
+	slot(file.header, usedOffset).Store(headerSize)
+	return file, nil
+}
+
+// Close marks the process as terminated for the LiveOnly aggregation, and it
+// releases the file descriptor. The file stays in place, such that counters
+// and histograms remain in the totals. Metrics obtained before Close remain
+// usable.
+func (file *File) Close() error {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	slot(file.header, closedOffset).Store(1)
+	return file.f.Close()
+}
+
+// Grow maps a new region with room for at least size bytes.
+func (file *File) grow(size int) error {
+	size = (size + segmentSize - 1) / segmentSize * segmentSize
+	if err := file.f.Truncate(int64(file.end + size)); err != nil {
+		return fmt.Errorf("multiproc: file growth: %w", err)
+	}
+	b, err := syscall.Mmap(int(file.f.Fd()), int64(file.end), size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("multiproc: file mapping: %w", err)
+	}
+	// mappings stay in place until the process terminates
+	file.mapping = b
+	file.mappingOffset = file.end
+	file.end += size
+	file.used = file.mappingOffset
+	return nil
+}
+
+// MustCounter returns the Counter for name with optional labels, as label-name
+// and label-value pairs. The same name and labels (in any order) get the same
+// instance. MustCounter panics on invalid names, on an odd number of labels,
+// on more than three label pairs, or when the file can not grow.
+func (file *File) MustCounter(name string, labels ...string) *Counter {
+	key := mustKey(name, labels, 3)
+
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if c, ok := file.counters[key]; ok {
+		return c
+	}
+	slots := file.mustAppend(counterKind, 0, key, nil, 1)
+	c := &Counter{value: &slots[0]}
+	file.counters[key] = c
+	return c
+}
+
+// MustInteger returns the Integer for name with optional labels, as label-name
+// and label-value pairs. The same name and labels (in any order) get the same
+// instance. MustInteger panics on invalid names, on an odd number of labels,
+// on more than three label pairs, or when the file can not grow. Repeated use
+// with another aggregation also panics.
+func (file *File) MustInteger(name string, agg Aggregation, labels ...string) *Integer {
+	if agg&^LiveOnly > Max {
+		panic("multiproc: unknown aggregation")
+	}
+	key := mustKey(name, labels, 3)
+
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if i, ok := file.integers[key]; ok {
+		if i.agg != agg {
+			panic("multiproc: integer in use with another aggregation")
+		}
+		return i
+	}
+	slots := file.mustAppend(integerKind, agg, key, nil, 1)
+	i := &Integer{value: (*atomic.Int64)(unsafe.Pointer(&slots[0])), agg: agg}
+	file.integers[key] = i
+	return i
+}
+
+// MustHistogram returns the Histogram for name with optional labels, as
+// label-name and label-value pairs. The same name and labels (in any order)
+// get the same instance. Bucket bounds are normalised like the metrics package
+// does. MustHistogram panics on invalid names, on an odd number of labels, on
+// more than two label pairs, or when the file can not grow. Repeated use with
+// other bucket bounds also panics.
+func (file *File) MustHistogram(name string, buckets []float64, labels ...string) *Histogram {
+	key := mustKey(name, labels, 2)
+	bucketBounds := bounds.Normalize(buckets)
+	if len(bucketBounds) > math.MaxUint16 {
+		panic("multiproc: too many histogram buckets")
+	}
+
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if h, ok := file.histograms[key]; ok {
+		if !bounds.Equal(h.BucketBounds, bucketBounds) {
+			panic("multiproc: histogram in use with other bucket bounds")
+		}
+		return h
+	}
+	slots := file.mustAppend(histogramKind, 0, key, bucketBounds, len(bucketBounds)+2)
+	h := &Histogram{BucketBounds: bucketBounds, slots: slots}
+	file.histograms[key] = h
+	return h
+}
+
+// MustAppend adds an entry, and it returns the slots. The mutex must be held.
+func (file *File) mustAppend(kind uint8, agg Aggregation, key string, bounds []float64, slotCount int) []atomic.Uint64 {
+	boundsOffset := (10 + len(key) + 7) &^ 7
+	slotsOffset := boundsOffset + len(bounds)*8
+	size := slotsOffset + slotCount*8
+	if size > math.MaxUint32 {
+		panic("multiproc: metric entry too large")
+	}
+
+	if file.used+size > file.mappingOffset+len(file.mapping) {
+		if err := file.grow(size); err != nil {
+			panic(err)
+		}
+	}
+	entry := file.mapping[file.used-file.mappingOffset:][:size]
+
+	binary.LittleEndian.PutUint32(entry[0:], uint32(size))
+	entry[4] = kind
+	entry[5] = uint8(agg)
+	binary.LittleEndian.PutUint16(entry[6:], uint16(len(bounds)))
+	binary.LittleEndian.PutUint16(entry[8:], uint16(len(key)))
+	copy(entry[10:], key)
+	for i, f := range bounds {
+		binary.LittleEndian.PutUint64(entry[boundsOffset+i*8:], math.Float64bits(f))
+	}
+	slots := unsafe.Slice((*atomic.Uint64)(unsafe.Pointer(&entry[slotsOffset])), slotCount)
+
+	// publish
+	file.used += size
+	slot(file.header, usedOffset).Store(uint64(file.used))
+	return slots
+}
+
+// Slot returns the 8-byte word at offset.
+func slot(b []byte, offset int) *atomic.Uint64 {
+	return (*atomic.Uint64)(unsafe.Pointer(&b[offset]))
+}
+
+// MustKey returns the binary encoding of a name with labels, as a sequence of
+// strings, each with a uint16 size. The labels are in order of name.
+func mustKey(name string, labels []string, maxPairs int) string {
+	mustValidName(name, false)
+	if len(labels)%2 != 0 {
+		panic("multiproc: labels not in name and value pairs")
+	}
+	if len(labels)/2 > maxPairs {
+		panic("multiproc: too many labels")
+	}
+
+	pairs := make([][2]string, len(labels)/2)
+	for i := range pairs {
+		pairs[i] = [2]string{labels[i*2], labels[i*2+1]}
+		mustValidName(pairs[i][0], true)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+
+	buf := appendKeyString(nil, name)
+	for i, p := range pairs {
+		if i != 0 && p[0] == pairs[i-1][0] {
+			panic("multiproc: duplicate label name")
+		}
+		buf = appendKeyString(buf, p[0])
+		buf = appendKeyString(buf, p[1])
+	}
+	if len(buf) > math.MaxUint16 {
+		panic("multiproc: labels too large")
+	}
+	return string(buf)
+}
+
+func appendKeyString(buf []byte, s string) []byte {
+	if len(s) > math.MaxUint16 {
+		panic("multiproc: label value too large")
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// ParseKey reverses mustKey.
+func parseKey(key string) (name string, labelNames, labelValues []string, err error) {
+	var a []string
+	for len(key) != 0 {
+		if len(key) < 2 {
+			return "", nil, nil, errors.New("malformed key")
+		}
+		size := int(binary.LittleEndian.Uint16([]byte(key[:2])))
+		if len(key) < 2+size {
+			return "", nil, nil, errors.New("malformed key")
+		}
+		a = append(a, key[2:2+size])
+		key = key[2+size:]
+	}
+	if len(a)%2 != 1 {
+		return "", nil, nil, errors.New("malformed key")
+	}
+	name = a[0]
+	for i := 1; i < len(a); i += 2 {
+		labelNames = append(labelNames, a[i])
+		labelValues = append(labelValues, a[i+1])
+	}
+	return name, labelNames, labelValues, nil
+}
+
+// MustValidName applies the syntax rules of the metrics package.
+func mustValidName(s string, label bool) {
+	if s == "" {
+		panic("multiproc: empty name")
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' && !label {
+			continue
+		}
+		if i == 0 || c < '0' || c > '9' {
+			panic("multiproc: name " + strconv.Quote(s) + " doesn't match the syntax of the metrics package")
+		}
+	}
+}
+
+// Counter is the counterpart of metrics.Counter.
+// Multiple goroutines may invoke methods on a Counter simultaneously.
+type Counter struct {
+	value *atomic.Uint64
+}
+
+// Get returns the current value of this process.
+func (c *Counter) Get() uint64 { return c.value.Load() }
+
+// Add increments the current value with n.
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Integer is the counterpart of metrics.Integer.
+// Multiple goroutines may invoke methods on an Integer simultaneously.
+type Integer struct {
+	value *atomic.Int64
+	agg   Aggregation
+}
+
+// Get returns the current value of this process.
+func (i *Integer) Get() int64 { return i.value.Load() }
+
+// Set replaces the current value with an update.
+func (i *Integer) Set(update int64) { i.value.Store(update) }
+
+// Add sums the current value with n.
+func (i *Integer) Add(n int64) { i.value.Add(n) }
+
+// Histogram is the counterpart of metrics.Histogram. Reads from a Collector
+// are not atomic, i.e., the sum may lag behind the buckets.
+// Multiple goroutines may invoke methods on a Histogram simultaneously.
+type Histogram struct {
+	// Upper value for each bucket, sorted, +Inf omitted.
+	// This field is read-only.
+	BucketBounds []float64
+
+	// bucket counts, +Inf included, followed by the float64 bits of the sum
+	slots []atomic.Uint64
+}
+
+// Add applies value to the countings.
+func (h *Histogram) Add(value float64) { h.AddN(value, 1) }
+
+// AddN applies value n times to the countings.
+func (h *Histogram) AddN(value float64, n uint64) {
+	if n == 0 {
+		return
+	}
+	h.slots[sort.SearchFloat64s(h.BucketBounds, value)].Add(n)
+
+	sum := &h.slots[len(h.slots)-1]
+	for {
+		oldBits := sum.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + value*float64(n))
+		if sum.CompareAndSwap(oldBits, newBits) {
+			break
+		}
+		// lost race
+		runtime.Gosched()
+	}
+}
+
+// Get appends the observation counts for each Histogram.BucketBounds of this
+// process to a, non-cumulative, and it returns the resulting slice (as
+// buckets). The count return includes the positive infinity bucket.
+func (h *Histogram) Get(a []uint64) (buckets []uint64, count uint64, sum float64) {
+	for i := range h.slots[:len(h.slots)-1] {
+		n := h.slots[i].Load()
+		if i < len(h.BucketBounds) {
+			a = append(a, n)
+		}
+		count += n
+	}
+	return a, count, math.Float64frombits(h.slots[len(h.slots)-1].Load())
+}
@@ -0,0 +1,244 @@
+//go:build unix
+
+package multiproc
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// A process ID which is not in use.
+const deadPID = 0x7ffffff0
+
+// TestWorkerProcess is the child of TestCrossProcess.
+func TestWorkerProcess(t *testing.T) {
+	dir := os.Getenv("MULTIPROC_TEST_DIR")
+	if dir == "" {
+		t.Skip("not a worker process")
+	}
+	file, err := Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.MustCounter("jobs_total", "queue", "high").Add(5)
+	file.MustHistogram("job_seconds", []float64{1}).Add(3)
+	file.MustInteger("workers", Sum).Set(1)
+	file.MustInteger("workers_live", Sum|LiveOnly).Set(1)
+	// exit without Close
+}
+
+func TestCrossProcess(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWorkerProcess$")
+		cmd.Env = append(os.Environ(), "MULTIPROC_TEST_DIR="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("worker process: %s\n%s", err, out)
+		}
+	}
+
+	reg := metrics.NewRegister()
+	c := NewCollector(reg, dir)
+	c.Help = map[string]string{"jobs_total": "Jobs done."}
+	if err := c.Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+
+	metrics.SkipTimestamp = true
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	got := buf.String()
+	for _, want := range []string{
+		"# HELP jobs_total Jobs done.\n",
+		"jobs_total{queue=\"high\"} 10\n",
+		"job_seconds{le=\"1\"} 0\n",
+		"job_seconds{le=\"+Inf\"} 2\n",
+		"job_seconds_sum 6\n",
+		"workers 2\n",
+		"workers_live 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant line %q", got, want)
+		}
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	dir := t.TempDir()
+	live, err := create(dir, os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := create(dir, deadPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*File{live, dead} {
+		// labels in any order
+		f.MustCounter("requests_total", "method", "GET", "code", "200").Add(3)
+	}
+	live.MustCounter("requests_total", "code", "200", "method", "GET").Add(1)
+
+	live.MustInteger("sum", Sum).Set(2)
+	dead.MustInteger("sum", Sum).Set(3)
+	live.MustInteger("min", Min).Set(2)
+	dead.MustInteger("min", Min).Set(-3)
+	live.MustInteger("max", Max).Set(2)
+	dead.MustInteger("max", Max).Set(3)
+	live.MustInteger("live_max", Max|LiveOnly).Set(2)
+	dead.MustInteger("live_max", Max|LiveOnly).Set(3)
+	dead.MustInteger("none", Min|LiveOnly).Set(3)
+
+	reg := metrics.NewRegister()
+	c := NewCollector(reg, dir)
+	if err := c.Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+	// once more to verify updates of existing registrations
+	live.MustCounter("requests_total", "code", "200", "method", "GET").Add(1)
+	if err := c.Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+
+	want := map[string]float64{
+		"requests_total": 8,
+		"sum":            5,
+		"min":            -3,
+		"max":            3,
+		"live_max":       2,
+	}
+	for _, f := range reg.Snapshot() {
+		if len(f.Series) != 1 {
+			t.Errorf("%s got %d series, want 1", f.Name, len(f.Series))
+			continue
+		}
+		got := f.Series[0].Value
+		if f.Name == "none" {
+			if !math.IsNaN(got) {
+				t.Errorf("%s got %g, want NaN", f.Name, got)
+			}
+			continue
+		}
+		if got != want[f.Name] {
+			t.Errorf("%s got %g, want %g", f.Name, got, want[f.Name])
+		}
+	}
+}
+
+func TestCloseNotLive(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MustInteger("connections", Sum|LiveOnly).Set(7)
+	f.MustCounter("connections_total").Add(9)
+	if err := f.Close(); err != nil {
+		t.Fatal("close error:", err)
+	}
+
+	reg := metrics.NewRegister()
+	if err := NewCollector(reg, dir).Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+	for _, f := range reg.Snapshot() {
+		if f.Name == "connections" && f.Series[0].Value != 0 {
+			t.Errorf("got connections %g after Close, want 0", f.Series[0].Value)
+		}
+		if f.Name == "connections_total" && f.Series[0].Value != 9 {
+			t.Errorf("got connections_total %g after Close, want 9", f.Series[0].Value)
+		}
+	}
+}
+
+func TestFileGrowth(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// several segments, with one histogram larger than a segment
+	big := make([]float64, segmentSize/8)
+	for i := range big {
+		big[i] = float64(i)
+	}
+	const n = 5000
+	for i := 0; i < n; i++ {
+		f.MustCounter("c", "i", strings.Repeat("x", i%100)+string(rune('a'+i%26))+string(rune('a'+i/26%26))+string(rune('a'+i/676))).Add(1)
+		if i == n/2 {
+			f.MustHistogram("big", big).Add(7)
+		}
+	}
+
+	reg := metrics.NewRegister()
+	if err := NewCollector(reg, dir).Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+	for _, fam := range reg.Snapshot() {
+		switch fam.Name {
+		case "c":
+			if len(fam.Series) != n {
+				t.Errorf("got %d counter series, want %d", len(fam.Series), n)
+			}
+		case "big":
+			if s := fam.Series[0]; s.Count != 1 || s.Buckets[7] != 1 {
+				t.Errorf("got histogram count %d with bucket 7 at %d, want 1 and 1", s.Count, s.Buckets[7])
+			}
+		}
+	}
+}
+
+func TestConflict(t *testing.T) {
+	dir := t.TempDir()
+	a, err := create(dir, os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := create(dir, deadPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.MustHistogram("h", []float64{1, 2})
+	b.MustHistogram("h", []float64{1, 3})
+	a.MustCounter("ok").Add(1)
+
+	reg := metrics.NewRegister()
+	if err := NewCollector(reg, dir).Capture(); err == nil {
+		t.Error("got no error for bucket bound conflict")
+	}
+	var names []string
+	for _, f := range reg.Snapshot() {
+		names = append(names, f.Name)
+	}
+	if len(names) != 1 || names[0] != "ok" {
+		t.Errorf("got metrics %q, want [ok] only", names)
+	}
+}
+
+func TestPIDReuse(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []uint64{3, 2} {
+		f, err := create(dir, deadPID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.MustCounter("jobs_total").Add(n)
+	}
+
+	reg := metrics.NewRegister()
+	if err := NewCollector(reg, dir).Capture(); err != nil {
+		t.Fatal("capture error:", err)
+	}
+	for _, f := range reg.Snapshot() {
+		if got := f.Series[0].Value; got != 5 {
+			t.Errorf("got %s %g with a reused process ID, want 5", f.Name, got)
+		}
+	}
+}
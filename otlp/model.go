@@ -0,0 +1,320 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// The data model is a subset of opentelemetry/proto/metrics/v1. Each type has
+// the JSON encoding in struct tags, and the protobuf encoding in appendProto.
+
+// AggregationTemporality enumeration
+const temporalityCumulative = 2
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+func (m *exportRequest) appendProto(buf []byte) []byte {
+	for i := range m.ResourceMetrics {
+		buf = appendMessageField(buf, 1, m.ResourceMetrics[i].appendProto)
+	}
+	return buf
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+func (m *resourceMetrics) appendProto(buf []byte) []byte {
+	buf = appendMessageField(buf, 1, m.Resource.appendProto)
+	for i := range m.ScopeMetrics {
+		buf = appendMessageField(buf, 2, m.ScopeMetrics[i].appendProto)
+	}
+	return buf
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+func (m *resource) appendProto(buf []byte) []byte {
+	return appendAttributes(buf, 1, m.Attributes)
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+func (m *keyValue) appendProto(buf []byte) []byte {
+	buf = appendStringField(buf, 1, m.Key)
+	return appendMessageField(buf, 2, m.Value.appendProto)
+}
+
+func appendAttributes(buf []byte, field uint64, attrs []keyValue) []byte {
+	for i := range attrs {
+		buf = appendMessageField(buf, field, attrs[i].appendProto)
+	}
+	return buf
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (m *anyValue) appendProto(buf []byte) []byte {
+	return appendStringField(buf, 1, m.StringValue)
+}
+
+type scopeMetrics struct {
+	Scope   instrumentationScope `json:"scope"`
+	Metrics []metric             `json:"metrics"`
+}
+
+func (m *scopeMetrics) appendProto(buf []byte) []byte {
+	buf = appendMessageField(buf, 1, m.Scope.appendProto)
+	for i := range m.Metrics {
+		buf = appendMessageField(buf, 2, m.Metrics[i].appendProto)
+	}
+	return buf
+}
+
+type instrumentationScope struct {
+	Name string `json:"name"`
+}
+
+func (m *instrumentationScope) appendProto(buf []byte) []byte {
+	return appendStringField(buf, 1, m.Name)
+}
+
+// Metric has one of Gauge, Sum, Histogram or Summary set.
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+	Summary     *summary   `json:"summary,omitempty"`
+}
+
+func (m *metric) appendProto(buf []byte) []byte {
+	buf = appendStringField(buf, 1, m.Name)
+	if m.Description != "" {
+		buf = appendStringField(buf, 2, m.Description)
+	}
+	switch {
+	case m.Gauge != nil:
+		buf = appendMessageField(buf, 5, m.Gauge.appendProto)
+	case m.Sum != nil:
+		buf = appendMessageField(buf, 7, m.Sum.appendProto)
+	case m.Histogram != nil:
+		buf = appendMessageField(buf, 9, m.Histogram.appendProto)
+	case m.Summary != nil:
+		buf = appendMessageField(buf, 11, m.Summary.appendProto)
+	}
+	return buf
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+func (m *gauge) appendProto(buf []byte) []byte {
+	for i := range m.DataPoints {
+		buf = appendMessageField(buf, 1, m.DataPoints[i].appendProto)
+	}
+	return buf
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+func (m *sum) appendProto(buf []byte) []byte {
+	for i := range m.DataPoints {
+		buf = appendMessageField(buf, 1, m.DataPoints[i].appendProto)
+	}
+	buf = appendVarintField(buf, 2, uint64(m.AggregationTemporality))
+	if m.IsMonotonic {
+		buf = appendVarintField(buf, 3, 1)
+	}
+	return buf
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+func (m *histogram) appendProto(buf []byte) []byte {
+	for i := range m.DataPoints {
+		buf = appendMessageField(buf, 1, m.DataPoints[i].appendProto)
+	}
+	return appendVarintField(buf, 2, uint64(m.AggregationTemporality))
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+func (m *summary) appendProto(buf []byte) []byte {
+	for i := range m.DataPoints {
+		buf = appendMessageField(buf, 1, m.DataPoints[i].appendProto)
+	}
+	return buf
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,omitempty,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	AsDouble          double     `json:"asDouble"`
+}
+
+func (m *numberDataPoint) appendProto(buf []byte) []byte {
+	if m.StartTimeUnixNano != 0 {
+		buf = appendFixed64Field(buf, 2, m.StartTimeUnixNano)
+	}
+	buf = appendFixed64Field(buf, 3, m.TimeUnixNano)
+	buf = appendFixed64Field(buf, 4, math.Float64bits(float64(m.AsDouble)))
+	return appendAttributes(buf, 7, m.Attributes)
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,omitempty,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	Count             uint64     `json:"count,string"`
+	Sum               double     `json:"sum"`
+	BucketCounts      uint64s    `json:"bucketCounts"`
+	ExplicitBounds    []double   `json:"explicitBounds"`
+}
+
+func (m *histogramDataPoint) appendProto(buf []byte) []byte {
+	if m.StartTimeUnixNano != 0 {
+		buf = appendFixed64Field(buf, 2, m.StartTimeUnixNano)
+	}
+	buf = appendFixed64Field(buf, 3, m.TimeUnixNano)
+	buf = appendFixed64Field(buf, 4, m.Count)
+	buf = appendFixed64Field(buf, 5, math.Float64bits(float64(m.Sum)))
+	buf = appendPackedFixed64Field(buf, 6, len(m.BucketCounts), func(i int) uint64 {
+		return m.BucketCounts[i]
+	})
+	buf = appendPackedFixed64Field(buf, 7, len(m.ExplicitBounds), func(i int) uint64 {
+		return math.Float64bits(float64(m.ExplicitBounds[i]))
+	})
+	return appendAttributes(buf, 9, m.Attributes)
+}
+
+type summaryDataPoint struct {
+	Attributes     []keyValue        `json:"attributes,omitempty"`
+	TimeUnixNano   uint64            `json:"timeUnixNano,string"`
+	Count          uint64            `json:"count,string"`
+	Sum            double            `json:"sum"`
+	QuantileValues []valueAtQuantile `json:"quantileValues"`
+}
+
+func (m *summaryDataPoint) appendProto(buf []byte) []byte {
+	buf = appendFixed64Field(buf, 3, m.TimeUnixNano)
+	buf = appendFixed64Field(buf, 4, m.Count)
+	buf = appendFixed64Field(buf, 5, math.Float64bits(float64(m.Sum)))
+	for i := range m.QuantileValues {
+		buf = appendMessageField(buf, 6, m.QuantileValues[i].appendProto)
+	}
+	return appendAttributes(buf, 7, m.Attributes)
+}
+
+type valueAtQuantile struct {
+	Quantile double `json:"quantile"`
+	Value    double `json:"value"`
+}
+
+func (m *valueAtQuantile) appendProto(buf []byte) []byte {
+	buf = appendFixed64Field(buf, 1, math.Float64bits(float64(m.Quantile)))
+	return appendFixed64Field(buf, 2, math.Float64bits(float64(m.Value)))
+}
+
+// Double has the JSON mapping of protobuf, which includes NaN and infinity.
+type double float64
+
+// MarshalJSON implements the json.Marshaler interface.
+func (f double) MarshalJSON() ([]byte, error) {
+	switch {
+	case math.IsNaN(float64(f)):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(float64(f), 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(float64(f), -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return strconv.AppendFloat(nil, float64(f), 'g', -1, 64), nil
+}
+
+// Uint64s has the JSON mapping of protobuf, which quotes 64-bit integers.
+type uint64s []uint64
+
+// MarshalJSON implements the json.Marshaler interface.
+func (a uint64s) MarshalJSON() ([]byte, error) {
+	buf := []byte{'['}
+	for i, v := range a {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '"')
+		buf = strconv.AppendUint(buf, v, 10)
+		buf = append(buf, '"')
+	}
+	return append(buf, ']'), nil
+}
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(buf []byte, field, wireType uint64) []byte {
+	return binary.AppendUvarint(buf, field<<3|wireType)
+}
+
+func appendVarintField(buf []byte, field, v uint64) []byte {
+	buf = appendTag(buf, field, wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendFixed64Field(buf []byte, field, v uint64) []byte {
+	buf = appendTag(buf, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, v)
+}
+
+func appendPackedFixed64Field(buf []byte, field uint64, n int, v func(i int) uint64) []byte {
+	if n == 0 {
+		return buf
+	}
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(n*8))
+	for i := 0; i < n; i++ {
+		buf = binary.LittleEndian.AppendUint64(buf, v(i))
+	}
+	return buf
+}
+
+func appendStringField(buf []byte, field uint64, s string) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// AppendMessageField appends an embedded message from appendProto.
+func appendMessageField(buf []byte, field uint64, appendProto func([]byte) []byte) []byte {
+	msg := appendProto(nil)
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(msg)))
+	return append(buf, msg...)
+}
@@ -0,0 +1,236 @@
+// Package otlp provides metric exports with the OpenTelemetry protocol over
+// HTTP (OTLP/HTTP), in either the binary protobuf or the JSON encoding.
+//
+// Counters become cumulative, monotonic sums. Integers, Reals and their Sample
+// equivalents become gauges. Histograms become cumulative histograms with
+// explicit buckets. Summaries become summaries. Labels become attributes.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// ScopeName is the instrumentation scope of all exports.
+const ScopeName = "github.com/pascaldekloe/metrics"
+
+// Exporter sends the content of a Register to an OTLP/HTTP endpoint.
+// Multiple goroutines may invoke methods on an Exporter simultaneously.
+type Exporter struct {
+	// URL is the metrics endpoint, e.g., "http://localhost:4318/v1/metrics".
+	URL string
+
+	// Header is added to each request, e.g., for Authorization.
+	Header http.Header
+
+	// HTTPClient is used for requests. The nil value defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// JSON selects the JSON encoding instead of binary protobuf.
+	JSON bool
+
+	// Resource has the attributes of the resource, e.g., "service.name".
+	Resource map[string]string
+
+	reg *metrics.Register
+
+	// start of the cumulative aggregation for live metrics
+	start time.Time
+}
+
+// NewExporter returns a new Exporter which sends the content of reg to url.
+// A nil reg defaults to the default register of the metrics package. The
+// start time of cumulative metrics is set to now.
+func NewExporter(reg *metrics.Register, url string) *Exporter {
+	return &Exporter{URL: url, reg: reg, start: time.Now()}
+}
+
+// Export sends a snapshot. Live metrics get the timestamp of now. Samples keep
+// their capture timestamp. Responses other than 2xx are returned as an error.
+func (e *Exporter) Export() error {
+	var families []metrics.Family
+	if e.reg == nil {
+		families = metrics.Snapshot()
+	} else {
+		families = e.reg.Snapshot()
+	}
+	req := newExportRequest(families, e.Resource, e.start, time.Now())
+
+	var body []byte
+	var contentType string
+	if e.JSON {
+		var err error
+		body, err = json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("otlp: %w", err)
+		}
+		contentType = "application/json"
+	} else {
+		body = req.appendProto(nil)
+		contentType = "application/x-protobuf"
+	}
+
+	r, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	for name, values := range e.Header {
+		r.Header[name] = values
+	}
+	r.Header.Set("Content-Type", contentType)
+
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp: endpoint status %q: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ExportEvery sends a snapshot with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel.
+func (e *Exporter) ExportEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		e.Export()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				e.Export()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func newExportRequest(families []metrics.Family, resourceAttrs map[string]string, start, now time.Time) *exportRequest {
+	startNanos := uint64(start.UnixNano())
+	nowNanos := uint64(now.UnixNano())
+
+	scope := scopeMetrics{Scope: instrumentationScope{Name: ScopeName}}
+	for _, f := range families {
+		if len(f.Series) == 0 {
+			continue
+		}
+		m := metric{Name: f.Name, Description: f.Help}
+
+		for _, s := range f.Series {
+			// live metrics accumulate since start; samples are unknown
+			timestamp, startTimestamp := nowNanos, startNanos
+			if s.Timestamp != 0 {
+				timestamp = s.Timestamp * uint64(time.Millisecond)
+				startTimestamp = 0
+			}
+			attrs := attributes(s.Labels)
+
+			switch f.Type {
+			case "counter":
+				if m.Sum == nil {
+					m.Sum = &sum{AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+				}
+				m.Sum.DataPoints = append(m.Sum.DataPoints, numberDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: startTimestamp,
+					TimeUnixNano:      timestamp,
+					AsDouble:          double(s.Value),
+				})
+
+			case "histogram":
+				if m.Histogram == nil {
+					m.Histogram = &histogram{AggregationTemporality: temporalityCumulative}
+				}
+				counts := make(uint64s, len(s.Buckets)+1)
+				copy(counts, s.Buckets)
+				inf := s.Count
+				for _, n := range s.Buckets {
+					inf -= n
+				}
+				counts[len(s.Buckets)] = inf
+				bounds := make([]double, len(s.BucketBounds))
+				for i, bound := range s.BucketBounds {
+					bounds[i] = double(bound)
+				}
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, histogramDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: startTimestamp,
+					TimeUnixNano:      timestamp,
+					Count:             s.Count,
+					Sum:               double(s.Sum),
+					BucketCounts:      counts,
+					ExplicitBounds:    bounds,
+				})
+
+			case "summary":
+				if m.Summary == nil {
+					m.Summary = new(summary)
+				}
+				quantiles := make([]valueAtQuantile, len(s.Quantiles))
+				for i, q := range s.Quantiles {
+					quantiles[i] = valueAtQuantile{double(q), double(s.QuantileValues[i])}
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, summaryDataPoint{
+					Attributes:     attrs,
+					TimeUnixNano:   timestamp,
+					Count:          s.Count,
+					Sum:            double(s.Sum),
+					QuantileValues: quantiles,
+				})
+
+			default:
+				if m.Gauge == nil {
+					m.Gauge = new(gauge)
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, numberDataPoint{
+					Attributes:   attrs,
+					TimeUnixNano: timestamp,
+					AsDouble:     double(s.Value),
+				})
+			}
+		}
+		scope.Metrics = append(scope.Metrics, m)
+	}
+
+	return &exportRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: attributes(resourceAttrs)},
+		ScopeMetrics: []scopeMetrics{scope},
+	}}}
+}
+
+// Attributes returns the labels in order of name.
+func attributes(labels map[string]string) []keyValue {
+	if len(labels) == 0 {
+		return nil
+	}
+	a := make([]keyValue, 0, len(labels))
+	for k, v := range labels {
+		a = append(a, keyValue{Key: k, Value: anyValue{StringValue: v}})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Key < a[j].Key })
+	return a
+}
@@ -0,0 +1,230 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func testRegister() *metrics.Register {
+	reg := metrics.NewRegister()
+	reg.Must1LabelCounter("requests_total", "method")("GET").Add(3)
+	reg.MustHelp("requests_total", "Requests served.")
+	reg.MustRealSample("temperature_celsius", "").Set(math.Inf(-1), time.UnixMilli(1615130567389))
+	h := reg.MustHistogram("latency_seconds", "", 0.1, 1)
+	h.Add(0.05)
+	h.Add(5)
+	return reg
+}
+
+// Receive returns an endpoint which passes each request body on the channel.
+func receive(t *testing.T, wantContentType string) (url string, bodies <-chan []byte) {
+	ch := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != wantContentType {
+			t.Errorf("got Content-Type %q, want %q", got, wantContentType)
+		}
+		body, _ := io.ReadAll(r.Body)
+		ch <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/v1/metrics", ch
+}
+
+func TestExportJSON(t *testing.T) {
+	url, bodies := receive(t, "application/json")
+	exp := NewExporter(testRegister(), url)
+	exp.JSON = true
+	exp.Resource = map[string]string{"service.name": "test"}
+	exp.start = time.Unix(1615130000, 0)
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal("malformed JSON:", err)
+	}
+	resourceMetrics := got["resourceMetrics"].([]any)[0].(map[string]any)
+
+	wantResource := map[string]any{"attributes": []any{
+		map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "test"}},
+	}}
+	if r := resourceMetrics["resource"]; !reflect.DeepEqual(r, wantResource) {
+		t.Errorf("got resource %v, want %v", r, wantResource)
+	}
+
+	scope := resourceMetrics["scopeMetrics"].([]any)[0].(map[string]any)
+	if name := scope["scope"].(map[string]any)["name"]; name != ScopeName {
+		t.Errorf("got scope name %q, want %q", name, ScopeName)
+	}
+	metrics := scope["metrics"].([]any)
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(metrics))
+	}
+
+	counter := metrics[0].(map[string]any)
+	if counter["name"] != "requests_total" || counter["description"] != "Requests served." {
+		t.Errorf("got counter %v", counter)
+	}
+	sum := counter["sum"].(map[string]any)
+	if sum["aggregationTemporality"] != 2.0 || sum["isMonotonic"] != true {
+		t.Errorf("got sum %v, want cumulative and monotonic", sum)
+	}
+	point := sum["dataPoints"].([]any)[0].(map[string]any)
+	if point["asDouble"] != 3.0 || point["startTimeUnixNano"] != "1615130000000000000" {
+		t.Errorf("got counter data point %v", point)
+	}
+
+	gauge := metrics[1].(map[string]any)["gauge"].(map[string]any)
+	point = gauge["dataPoints"].([]any)[0].(map[string]any)
+	if point["asDouble"] != "-Infinity" || point["timeUnixNano"] != "1615130567389000000" {
+		t.Errorf("got gauge data point %v", point)
+	}
+	if _, ok := point["startTimeUnixNano"]; ok {
+		t.Error("got start time on gauge")
+	}
+
+	histogram := metrics[2].(map[string]any)["histogram"].(map[string]any)
+	point = histogram["dataPoints"].([]any)[0].(map[string]any)
+	if !reflect.DeepEqual(point["bucketCounts"], []any{"1", "0", "1"}) {
+		t.Errorf("got bucket counts %v, want [1 0 1]", point["bucketCounts"])
+	}
+	if !reflect.DeepEqual(point["explicitBounds"], []any{0.1, 1.0}) {
+		t.Errorf("got explicit bounds %v, want [0.1 1]", point["explicitBounds"])
+	}
+	if point["count"] != "2" || point["sum"] != 5.05 {
+		t.Errorf("got histogram data point %v", point)
+	}
+}
+
+func TestExportProtobuf(t *testing.T) {
+	url, bodies := receive(t, "application/x-protobuf")
+	exp := NewExporter(testRegister(), url)
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	body := <-bodies
+
+	// ExportMetricsServiceRequest.resource_metrics.scope_metrics.metrics
+	metrics := fieldBytes(t, body, 1)
+	metrics = fieldBytes(t, metrics[0], 2)
+	metrics = fieldBytes(t, metrics[0], 2)
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(metrics))
+	}
+
+	var names []string
+	for _, m := range metrics {
+		names = append(names, string(fieldBytes(t, m, 1)[0]))
+	}
+	if want := []string{"requests_total", "temperature_celsius", "latency_seconds"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got metric names %q, want %q", names, want)
+	}
+
+	sum := fieldBytes(t, metrics[0], 7)[0]
+	if got := fieldValues(t, sum, 3); !reflect.DeepEqual(got, []uint64{1}) {
+		t.Errorf("got is_monotonic %v, want [1]", got)
+	}
+	point := fieldBytes(t, sum, 1)[0]
+	if got := fieldValues(t, point, 4); len(got) != 1 || math.Float64frombits(got[0]) != 3 {
+		t.Errorf("got as_double %v, want 3", got)
+	}
+	attr := fieldBytes(t, point, 7)[0]
+	if key := string(fieldBytes(t, attr, 1)[0]); key != "method" {
+		t.Errorf("got attribute key %q, want method", key)
+	}
+
+	histogram := fieldBytes(t, metrics[2], 9)[0]
+	point = fieldBytes(t, histogram, 1)[0]
+	packed := fieldBytes(t, point, 6)[0]
+	var counts []uint64
+	for i := 0; i+8 <= len(packed); i += 8 {
+		counts = append(counts, binary.LittleEndian.Uint64(packed[i:]))
+	}
+	if want := []uint64{1, 0, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("got bucket counts %v, want %v", counts, want)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unsupported", http.StatusUnsupportedMediaType)
+	}))
+	defer srv.Close()
+
+	if err := NewExporter(metrics.NewRegister(), srv.URL).Export(); err == nil {
+		t.Error("got no error for status 415")
+	}
+}
+
+type field struct {
+	num uint64
+	v   uint64 // varint or fixed64
+	b   []byte // length-delimited
+}
+
+func parseFields(t *testing.T, p []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(p) != 0 {
+		key, n := binary.Uvarint(p)
+		if n <= 0 {
+			t.Fatal("malformed field key")
+		}
+		p = p[n:]
+		f := field{num: key >> 3}
+		switch key & 7 {
+		case wireVarint:
+			f.v, n = binary.Uvarint(p)
+			if n <= 0 {
+				t.Fatal("malformed varint")
+			}
+			p = p[n:]
+		case wireFixed64:
+			f.v = binary.LittleEndian.Uint64(p)
+			p = p[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(p)
+			if n <= 0 || uint64(len(p)-n) < size {
+				t.Fatal("malformed length-delimited")
+			}
+			f.b = p[n : n+int(size)]
+			p = p[n+int(size):]
+		default:
+			t.Fatalf("unsupported wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func fieldBytes(t *testing.T, p []byte, num uint64) [][]byte {
+	t.Helper()
+	var a [][]byte
+	for _, f := range parseFields(t, p) {
+		if f.num == num {
+			a = append(a, f.b)
+		}
+	}
+	return a
+}
+
+func fieldValues(t *testing.T, p []byte, num uint64) []uint64 {
+	t.Helper()
+	var a []uint64
+	for _, f := range parseFields(t, p) {
+		if f.num == num {
+			a = append(a, f.v)
+		}
+	}
+	return a
+}
@@ -0,0 +1,222 @@
+// Package procstat provides process statistics to the default registry.
+//
+// The bindings are equivalent to the standard client implementation. See the
+// prometheus.NewProcessCollector function documentation for details. Readings
+// come from the proc filesystem, which makes the package specific to Linux.
+package procstat
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Process Samples
+var (
+	CPUTime       = metrics.MustCounterSample("process_cpu_seconds_total", "Total user and system CPU time spent in seconds.")
+	OpenFDs       = metrics.MustRealSample("process_open_fds", "Number of open file descriptors.")
+	MaxFDs        = metrics.MustRealSample("process_max_fds", "Maximum number of open file descriptors.")
+	VirtualMemory = metrics.MustRealSample("process_virtual_memory_bytes", "Virtual memory size in bytes.")
+	VirtualMax    = metrics.MustRealSample("process_virtual_memory_max_bytes", "Maximum amount of virtual memory available in bytes.")
+	Resident      = metrics.MustRealSample("process_resident_memory_bytes", "Resident memory size in bytes.")
+	StartTime     = metrics.MustRealSample("process_start_time_seconds", "Start time of the process since unix epoch in seconds.")
+)
+
+// UserHZ is the number of clock ticks per second, i.e., sysconf(_SC_CLK_TCK),
+// which is 100 on practically all Linux configurations.
+const userHZ = 100
+
+// Capture updates the samples. The first error encountered is returned, yet
+// all readings are attempted regardless.
+func Capture() error {
+	return capture("/proc")
+}
+
+// CaptureEvery updates the samples with an interval, starting now. Errors are
+// ignored, i.e., samples keep their last capture (if any) on failure.
+// The routine terminates with a send or close on cancel.
+func CaptureEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		Capture()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				Capture()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Capture reads from a proc filesystem mounted at root.
+func capture(root string) error {
+	err1 := captureStat(root)
+	err2 := captureLimits(root)
+	err3 := captureFDs(root)
+	switch {
+	case err1 != nil:
+		return err1
+	case err2 != nil:
+		return err2
+	default:
+		return err3
+	}
+}
+
+func captureStat(root string) error {
+	text, err := os.ReadFile(filepath.Join(root, "self", "stat"))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now()
+
+	// command name may contain any character, including parenthesis
+	i := bytes.LastIndexByte(text, ')')
+	if i < 0 {
+		return errors.New("procstat: no command name end in stat file")
+	}
+	// fields start at index 3, i.e., the process state
+	fields := strings.Fields(string(text[i+1:]))
+	if len(fields) < 22 {
+		return fmt.Errorf("procstat: got %d fields in stat file, want 24 or more", len(fields)+2)
+	}
+	field := func(index int) (uint64, error) {
+		n, err := strconv.ParseUint(fields[index-3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("procstat: stat file field %d: %w", index, err)
+		}
+		return n, nil
+	}
+
+	utime, err := field(14)
+	if err != nil {
+		return err
+	}
+	stime, err := field(15)
+	if err != nil {
+		return err
+	}
+	starttime, err := field(22)
+	if err != nil {
+		return err
+	}
+	vsize, err := field(23)
+	if err != nil {
+		return err
+	}
+	rss, err := field(24)
+	if err != nil {
+		return err
+	}
+
+	CPUTime.Set(float64(utime+stime)/userHZ, timestamp)
+	VirtualMemory.Set(float64(vsize), timestamp)
+	Resident.Set(float64(rss)*float64(os.Getpagesize()), timestamp)
+
+	bootTime, err := readBootTime(root)
+	if err != nil {
+		return err
+	}
+	StartTime.Set(float64(bootTime)+float64(starttime)/userHZ, timestamp)
+	return nil
+}
+
+// ReadBootTime returns the btime entry from the kernel statistics.
+func readBootTime(root string) (uint64, error) {
+	f, err := os.Open(filepath.Join(root, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "btime ") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(line[6:]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("procstat: malformed btime in stat file: %w", err)
+		}
+		return n, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("procstat: no btime in stat file")
+}
+
+func captureLimits(root string) error {
+	f, err := os.Open(filepath.Join(root, "self", "limits"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	timestamp := time.Now()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var s *metrics.Sample
+		switch {
+		case strings.HasPrefix(line, "Max open files "):
+			s = MaxFDs
+			line = line[len("Max open files "):]
+		case strings.HasPrefix(line, "Max address space "):
+			s = VirtualMax
+			line = line[len("Max address space "):]
+		default:
+			continue
+		}
+
+		// soft limit applies
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return errors.New("procstat: limit without value in limits file")
+		}
+		if fields[0] == "unlimited" {
+			s.Set(math.Inf(1), timestamp)
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("procstat: malformed limit in limits file: %w", err)
+		}
+		s.Set(float64(n), timestamp)
+	}
+	return scanner.Err()
+}
+
+func captureFDs(root string) error {
+	d, err := os.Open(filepath.Join(root, "self", "fd"))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	OpenFDs.Set(float64(len(names)), time.Now())
+	return nil
+}
@@ -0,0 +1,97 @@
+package procstat
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// NewFixture returns a fake proc filesystem.
+func newFixture(t *testing.T) (root string) {
+	root = t.TempDir()
+	for _, dir := range []string{"self", "self/fd"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"stat":        "cpu  10 0 10 1000 0 0 0 0 0 0\nbtime 1700000000\nprocesses 42\n",
+		"self/stat":   "4242 (odd) name) S 1 4242 4242 0 -1 4194560 1061 0 0 0 150 50 0 0 20 0 9 0 12345 1261568000 2570 18446744073709551615 1 1 0 0 0 0 0 0 2143420159 0 0 0 17 3 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		"self/limits": "Limit                     Soft Limit           Hard Limit           Units     \nMax cpu time              unlimited            unlimited            seconds   \nMax open files            1024                 524288               files     \nMax address space         unlimited            unlimited            bytes     \n",
+		"self/fd/0":   "",
+		"self/fd/1":   "",
+		"self/fd/2":   "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCaptureFixture(t *testing.T) {
+	if err := capture(newFixture(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := []struct {
+		s    *metrics.Sample
+		want float64
+	}{
+		{CPUTime, 2},
+		{OpenFDs, 3},
+		{MaxFDs, 1024},
+		{VirtualMemory, 1261568000},
+		{VirtualMax, math.Inf(1)},
+		{Resident, 2570 * float64(os.Getpagesize())},
+		{StartTime, 1700000123.45},
+	}
+	for _, gold := range golden {
+		if got, _ := gold.s.Get(); got != gold.want {
+			t.Errorf("%s got %g, want %g", gold.s.Name(), got, gold.want)
+		}
+	}
+}
+
+func TestCaptureErrors(t *testing.T) {
+	if err := capture(t.TempDir()); err == nil {
+		t.Error("no error on empty root")
+	}
+
+	root := newFixture(t)
+	if err := os.WriteFile(filepath.Join(root, "self", "stat"), []byte("4242 (short) S 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := capture(root); err == nil {
+		t.Error("no error on short stat file")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("proc filesystem requires Linux")
+	}
+	if err := Capture(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	for _, want := range []string{
+		"\n# TYPE process_cpu_seconds_total counter\n",
+		"\nprocess_open_fds ",
+		"\nprocess_resident_memory_bytes ",
+		"\nprocess_start_time_seconds ",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
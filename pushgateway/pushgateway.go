@@ -0,0 +1,151 @@
+// Package pushgateway provides metric exports to a Prometheus Pushgateway.
+package pushgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Client pushes the content of a Register to a Pushgateway. Multiple
+// goroutines may invoke methods on a Client simultaneously.
+type Client struct {
+	// URL is the root of the Pushgateway, e.g., "http://localhost:9091".
+	URL string
+
+	// Header is added to each request, e.g., for Authorization.
+	Header http.Header
+
+	// HTTPClient is used for requests. The nil value defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	reg *metrics.Register
+}
+
+// NewClient returns a new Client which pushes the content of reg to the
+// Pushgateway at url. A nil reg defaults to the default register of the
+// metrics package.
+func NewClient(reg *metrics.Register, url string) *Client {
+	return &Client{URL: url, reg: reg}
+}
+
+// Push replaces all metrics in the group with the content of the Register
+// (with HTTP PUT). The grouping key consists of the job label plus any labels
+// in grouping.
+func (c *Client) Push(job string, grouping map[string]string) error {
+	return c.push(http.MethodPut, job, grouping)
+}
+
+// PushAdd replaces the metrics in the group with the same name as the ones in
+// the Register (with HTTP POST). See Push for the arguments.
+func (c *Client) PushAdd(job string, grouping map[string]string) error {
+	return c.push(http.MethodPost, job, grouping)
+}
+
+// Delete removes all metrics in the group. See Push for the arguments.
+func (c *Client) Delete(job string, grouping map[string]string) error {
+	u, err := groupURL(c.URL, job, grouping)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodDelete, u, nil)
+}
+
+// Push sends the text format without any timestamps, as Pushgateway rejects
+// those.
+func (c *Client) push(method, job string, grouping map[string]string) error {
+	u, err := groupURL(c.URL, job, grouping)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	if c.reg == nil {
+		_, err = metrics.WriteUntimedTo(&body)
+	} else {
+		_, err = c.reg.WriteUntimedTo(&body)
+	}
+	if err != nil {
+		return err
+	}
+	return c.do(method, u, body.Bytes())
+}
+
+func (c *Client) do(method, u string, body []byte) error {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("pushgateway: %w", err)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushgateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway: %s %s got status %q: %s", method, u, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// GroupURL returns the URL of the grouping key. Values which don't fit into
+// a path segment are encoded in base64.
+func groupURL(gateway, job string, grouping map[string]string) (string, error) {
+	if job == "" {
+		return "", fmt.Errorf("pushgateway: empty job name")
+	}
+
+	var buf strings.Builder
+	buf.WriteString(strings.TrimSuffix(gateway, "/"))
+	buf.WriteString("/metrics")
+	writeSegment(&buf, "job", job)
+
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		if name == "job" {
+			return "", fmt.Errorf("pushgateway: job label in grouping; use job argument instead")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeSegment(&buf, name, grouping[name])
+	}
+	return buf.String(), nil
+}
+
+func writeSegment(buf *strings.Builder, name, value string) {
+	buf.WriteByte('/')
+	buf.WriteString(name)
+	switch {
+	case value == "":
+		buf.WriteString("@base64/=")
+	case strings.ContainsRune(value, '/'):
+		buf.WriteString("@base64/")
+		buf.WriteString(base64.RawURLEncoding.EncodeToString([]byte(value)))
+	default:
+		buf.WriteByte('/')
+		buf.WriteString(url.PathEscape(value))
+	}
+}
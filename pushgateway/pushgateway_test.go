@@ -0,0 +1,105 @@
+package pushgateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+type request struct {
+	Method, Path, Auth, Body string
+}
+
+func recordServer(t *testing.T, status int) (*httptest.Server, *[]request) {
+	var got []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, request{r.Method, r.URL.EscapedPath(), r.Header.Get("Authorization"), string(body)})
+		if status/100 != 2 {
+			http.Error(w, "pushed metrics are invalid", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestPush(t *testing.T) {
+	srv, got := recordServer(t, http.StatusOK)
+
+	reg := metrics.NewRegister()
+	reg.Must1LabelCounter("backups_total", "disk")("sd\"a").Add(2)
+	reg.MustHelp("backups_total", "Backups\ndone.")
+	reg.MustRealSample("last_backup_seconds", "").Set(3.5, time.Now())
+	reg.MustInteger("idle", "")
+	h := reg.MustHistogram("backup_seconds", "", 10)
+	h.Add(5)
+
+	c := NewClient(reg, srv.URL+"/")
+	c.Header = http.Header{"Authorization": {"Basic secret"}}
+	if err := c.Push("backup", map[string]string{"instance": "db1", "path": "/var/lib", "zone": ""}); err != nil {
+		t.Fatal("push error:", err)
+	}
+	if err := c.PushAdd("backup", nil); err != nil {
+		t.Fatal("push add error:", err)
+	}
+	if err := c.Delete("backup", map[string]string{"instance": "db1"}); err != nil {
+		t.Fatal("delete error:", err)
+	}
+
+	if len(*got) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*got))
+	}
+	wantBody := `# Prometheus Samples
+
+# TYPE backups_total counter
+# HELP backups_total Backups\ndone.
+backups_total{disk="sd\"a"} 2
+
+# TYPE last_backup_seconds gauge
+last_backup_seconds 3.5
+
+# TYPE idle gauge
+idle 0
+
+# TYPE backup_seconds histogram
+backup_seconds_count 1
+backup_seconds{le="10"} 1
+backup_seconds{le="+Inf"} 1
+backup_seconds_sum 5
+`
+	want := []request{
+		{"PUT", "/metrics/job/backup/instance/db1/path@base64/L3Zhci9saWI/zone@base64/=", "Basic secret", wantBody},
+		{"POST", "/metrics/job/backup", "Basic secret", wantBody},
+		{"DELETE", "/metrics/job/backup/instance/db1", "Basic secret", ""},
+	}
+	for i, w := range want {
+		if (*got)[i] != w {
+			t.Errorf("request %d got %+v", i, (*got)[i])
+			t.Errorf("request %d want %+v", i, w)
+		}
+	}
+}
+
+func TestPushError(t *testing.T) {
+	srv, _ := recordServer(t, http.StatusBadRequest)
+
+	c := NewClient(metrics.NewRegister(), srv.URL)
+	err := c.Push("job", nil)
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "pushed metrics are invalid") {
+		t.Errorf("got error %v, want status 400 with message", err)
+	}
+
+	if err := c.Delete("", nil); err == nil {
+		t.Error("empty job got no error")
+	}
+	if err := c.Delete("a", map[string]string{"job": "b"}); err == nil {
+		t.Error("job label in grouping got no error")
+	}
+}
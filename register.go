@@ -12,21 +12,48 @@ const (
 	realID
 	realSampleID
 	histogramID
+	histogramSampleID
+	summarySampleID
+	realCounterID
+	shardedCounterID
+	shardedIntegerID
 )
 
 // Help comments may have any [!] byte content, i.e., there is no illegal value.
 var helpEscapes = strings.NewReplacer("\n", `\n`, `\`, `\\`)
 
+// TypeName returns the Prometheus type of a typeID.
+func typeName(typeID uint) string {
+	switch typeID {
+	case counterID, counterSampleID, realCounterID, shardedCounterID:
+		return "counter"
+	case histogramID, histogramSampleID:
+		return "histogram"
+	case summarySampleID:
+		return "summary"
+	default:
+		return "gauge"
+	}
+}
+
 // Metric is a named record.
 type metric struct {
 	typeID   uint
+	name     string
+	help     string // optional
 	comments string // TYPE + optional HELP
 
-	counter   *Counter
-	integer   *Integer
-	real      *Real
-	histogram *Histogram
-	sample    *Sample
+	counter        *Counter
+	integer        *Integer
+	real           *Real
+	realCounter    *RealCounter
+	shardedCounter *ShardedCounter
+	shardedInteger *ShardedInteger
+	histogram      *Histogram
+	sample         *Sample
+	summary        *SummarySample
+
+	histogramSample *HistogramSample
 
 	labels []*labelMapping
 }
@@ -37,14 +64,8 @@ func newMetric(name, help string, typeID uint) *metric {
 	buf.Grow(len(name)*2 + len(help) + 27)
 	buf.WriteString("\n# TYPE ")
 	buf.WriteString(name)
-	switch typeID {
-	case counterID, counterSampleID:
-		buf.WriteString(" counter")
-	case integerID, realID, realSampleID:
-		buf.WriteString(" gauge")
-	case histogramID:
-		buf.WriteString(" histogram")
-	}
+	buf.WriteByte(' ')
+	buf.WriteString(typeName(typeID))
 	if help != "" {
 		buf.WriteString("\n# HELP ")
 		buf.WriteString(name)
@@ -53,7 +74,7 @@ func newMetric(name, help string, typeID uint) *metric {
 	}
 	buf.WriteByte('\n')
 
-	return &metric{typeID: typeID, comments: buf.String()}
+	return &metric{typeID: typeID, name: name, help: help, comments: buf.String()}
 }
 
 func (m *metric) mustLabel(name, labelName1, labelName2, labelName3 string) *labelMapping {
@@ -195,6 +216,80 @@ func (reg *Register) MustReal(name, help string) *Real {
 	return m.real
 }
 
+// MustRealCounter registers a new RealCounter. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text. Negative and
+// not-a-number (NaN) increments are dropped silently.
+func MustRealCounter(name, help string) *RealCounter {
+	return std.MustRealCounter(name, help)
+}
+
+// MustRealCounter registers a new RealCounter. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text. Negative and
+// not-a-number (NaN) increments are dropped silently.
+func (reg *Register) MustRealCounter(name, help string) *RealCounter {
+	mustValidMetricName(name)
+	m := newMetric(name, help, realCounterID)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	m = reg.mustGetOrSetMetric(name, m)
+	if m.realCounter != nil {
+		panic("metrics: name already in use")
+	}
+	m.realCounter = &RealCounter{prefix: name + " "}
+	return m.realCounter
+}
+
+// MustShardedCounter registers a new ShardedCounter. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+func MustShardedCounter(name, help string) *ShardedCounter {
+	return std.MustShardedCounter(name, help)
+}
+
+// MustShardedCounter registers a new ShardedCounter. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+func (reg *Register) MustShardedCounter(name, help string) *ShardedCounter {
+	mustValidMetricName(name)
+	m := newMetric(name, help, shardedCounterID)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	m = reg.mustGetOrSetMetric(name, m)
+	if m.shardedCounter != nil {
+		panic("metrics: name already in use")
+	}
+	m.shardedCounter = newShardedCounter(name + " ")
+	return m.shardedCounter
+}
+
+// MustShardedInteger registers a new ShardedInteger. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+func MustShardedInteger(name, help string) *ShardedInteger {
+	return std.MustShardedInteger(name, help)
+}
+
+// MustShardedInteger registers a new ShardedInteger. Registration panics when name
+// was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+func (reg *Register) MustShardedInteger(name, help string) *ShardedInteger {
+	mustValidMetricName(name)
+	m := newMetric(name, help, shardedIntegerID)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	m = reg.mustGetOrSetMetric(name, m)
+	if m.shardedInteger != nil {
+		panic("metrics: name already in use")
+	}
+	m.shardedInteger = newShardedInteger(name + " ")
+	return m.shardedInteger
+}
+
 // MustHistogram registers a new Histogram. Registration panics when name
 // was registered before, or when name doesn't match regular expression
 // [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
@@ -210,7 +305,8 @@ func MustHistogram(name, help string, buckets ...float64) *Histogram {
 // [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
 //
 // Buckets are defined as upper boundary values, with positive infinity
-// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored. See
+// LinearBuckets, ExponentialBuckets and DefBuckets for common layouts.
 func (reg *Register) MustHistogram(name, help string, buckets ...float64) *Histogram {
 	mustValidMetricName(name)
 	m := newMetric(name, help, histogramID)
@@ -274,6 +370,64 @@ func (reg *Register) MustCounterSample(name, help string) *Sample {
 	return m.sample
 }
 
+// MustHistogramSample registers a new HistogramSample. Registration panics
+// when name was registered before, or when name doesn't match regular
+// expression [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func MustHistogramSample(name, help string, buckets ...float64) *HistogramSample {
+	return std.MustHistogramSample(name, help, buckets...)
+}
+
+// MustHistogramSample registers a new HistogramSample. Registration panics
+// when name was registered before, or when name doesn't match regular
+// expression [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func (reg *Register) MustHistogramSample(name, help string, buckets ...float64) *HistogramSample {
+	mustValidMetricName(name)
+	m := newMetric(name, help, histogramSampleID)
+	h := newHistogramSample(name, buckets)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	m = reg.mustGetOrSetMetric(name, m)
+	if m.histogramSample != nil {
+		panic("metrics: name already in use")
+	}
+	m.histogramSample = h
+	return h
+}
+
+// MustSummarySample registers a new SummarySample. Registration panics when
+// name was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text. Quantiles must
+// be in ascending order, within the range of 0 to 1 (inclusive).
+func MustSummarySample(name, help string, quantiles ...float64) *SummarySample {
+	return std.MustSummarySample(name, help, quantiles...)
+}
+
+// MustSummarySample registers a new SummarySample. Registration panics when
+// name was registered before, or when name doesn't match regular expression
+// [a-zA-Z_:][a-zA-Z0-9_:]*. Help is an optional comment text. Quantiles must
+// be in ascending order, within the range of 0 to 1 (inclusive).
+func (reg *Register) MustSummarySample(name, help string, quantiles ...float64) *SummarySample {
+	mustValidMetricName(name)
+	m := newMetric(name, help, summarySampleID)
+	s := newSummarySample(name, quantiles)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	m = reg.mustGetOrSetMetric(name, m)
+	if m.summary != nil {
+		panic("metrics: name already in use")
+	}
+	m.summary = s
+	return s
+}
+
 // Must1LabelCounter returns a function which registers a dedicated Counter
 // for each unique label combination. Multiple goroutines may invoke the
 // returned simultaneously. Remember that each Counter represents a new time
@@ -658,6 +812,390 @@ func (reg *Register) Must3LabelReal(name, label1Name, label2Name, label3Name str
 	}
 }
 
+// Must1LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func Must1LabelRealCounter(name, labelName string) func(labelValue string) *RealCounter {
+	return std.Must1LabelRealCounter(name, labelName)
+}
+
+// Must1LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func (reg *Register) Must1LabelRealCounter(name, labelName string) func(labelValue string) *RealCounter {
+	mustValidNames(name, labelName)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, realCounterID).mustLabel(name, labelName, "", "")
+
+	return l.realCounter1
+}
+
+// Must2LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must2LabelRealCounter(name, label1Name, label2Name string) func(label1Value, label2Value string) *RealCounter {
+	return std.Must2LabelRealCounter(name, label1Name, label2Name)
+}
+
+// Must2LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must2LabelRealCounter(name, label1Name, label2Name string) func(label1Value, label2Value string) *RealCounter {
+	mustValidNames(name, label1Name, label2Name)
+
+	var flip bool
+	if label1Name > label2Name {
+		label1Name, label2Name = label2Name, label1Name
+		flip = true
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, realCounterID).mustLabel(name, label1Name, label2Name, "")
+
+	if flip {
+		return l.realCounter21
+	}
+	return l.realCounter12
+}
+
+// Must3LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must3LabelRealCounter(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *RealCounter {
+	return std.Must3LabelRealCounter(name, label1Name, label2Name, label3Name)
+}
+
+// Must3LabelRealCounter returns a function which registers a dedicated RealCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each RealCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must3LabelRealCounter(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *RealCounter {
+	mustValidNames(name, label1Name, label2Name, label3Name)
+
+	order := sort3(&label1Name, &label2Name, &label3Name)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, realCounterID).mustLabel(name, label1Name, label2Name, label3Name)
+
+	switch order {
+	case order123:
+		return l.realCounter123
+	case order132:
+		return l.realCounter132
+	case order213:
+		return l.realCounter213
+	case order231:
+		return l.realCounter231
+	case order312:
+		return l.realCounter312
+	case order321:
+		return l.realCounter321
+	default:
+		panic(order)
+	}
+}
+
+// Must1LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func Must1LabelShardedCounter(name, labelName string) func(labelValue string) *ShardedCounter {
+	return std.Must1LabelShardedCounter(name, labelName)
+}
+
+// Must1LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func (reg *Register) Must1LabelShardedCounter(name, labelName string) func(labelValue string) *ShardedCounter {
+	mustValidNames(name, labelName)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedCounterID).mustLabel(name, labelName, "", "")
+
+	return l.shardedCounter1
+}
+
+// Must2LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must2LabelShardedCounter(name, label1Name, label2Name string) func(label1Value, label2Value string) *ShardedCounter {
+	return std.Must2LabelShardedCounter(name, label1Name, label2Name)
+}
+
+// Must2LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must2LabelShardedCounter(name, label1Name, label2Name string) func(label1Value, label2Value string) *ShardedCounter {
+	mustValidNames(name, label1Name, label2Name)
+
+	var flip bool
+	if label1Name > label2Name {
+		label1Name, label2Name = label2Name, label1Name
+		flip = true
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedCounterID).mustLabel(name, label1Name, label2Name, "")
+
+	if flip {
+		return l.shardedCounter21
+	}
+	return l.shardedCounter12
+}
+
+// Must3LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must3LabelShardedCounter(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *ShardedCounter {
+	return std.Must3LabelShardedCounter(name, label1Name, label2Name, label3Name)
+}
+
+// Must3LabelShardedCounter returns a function which registers a dedicated ShardedCounter
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedCounter represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must3LabelShardedCounter(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *ShardedCounter {
+	mustValidNames(name, label1Name, label2Name, label3Name)
+
+	order := sort3(&label1Name, &label2Name, &label3Name)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedCounterID).mustLabel(name, label1Name, label2Name, label3Name)
+
+	switch order {
+	case order123:
+		return l.shardedCounter123
+	case order132:
+		return l.shardedCounter132
+	case order213:
+		return l.shardedCounter213
+	case order231:
+		return l.shardedCounter231
+	case order312:
+		return l.shardedCounter312
+	case order321:
+		return l.shardedCounter321
+	default:
+		panic(order)
+	}
+}
+
+// Must1LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func Must1LabelShardedInteger(name, labelName string) func(labelValue string) *ShardedInteger {
+	return std.Must1LabelShardedInteger(name, labelName)
+}
+
+// Must1LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+func (reg *Register) Must1LabelShardedInteger(name, labelName string) func(labelValue string) *ShardedInteger {
+	mustValidNames(name, labelName)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedIntegerID).mustLabel(name, labelName, "", "")
+
+	return l.shardedInteger1
+}
+
+// Must2LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must2LabelShardedInteger(name, label1Name, label2Name string) func(label1Value, label2Value string) *ShardedInteger {
+	return std.Must2LabelShardedInteger(name, label1Name, label2Name)
+}
+
+// Must2LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must2LabelShardedInteger(name, label1Name, label2Name string) func(label1Value, label2Value string) *ShardedInteger {
+	mustValidNames(name, label1Name, label2Name)
+
+	var flip bool
+	if label1Name > label2Name {
+		label1Name, label2Name = label2Name, label1Name
+		flip = true
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedIntegerID).mustLabel(name, label1Name, label2Name, "")
+
+	if flip {
+		return l.shardedInteger21
+	}
+	return l.shardedInteger12
+}
+
+// Must3LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func Must3LabelShardedInteger(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *ShardedInteger {
+	return std.Must3LabelShardedInteger(name, label1Name, label2Name, label3Name)
+}
+
+// Must3LabelShardedInteger returns a function which registers a dedicated ShardedInteger
+// for each unique label combination. Multiple goroutines may invoke the
+// returned simultaneously. Remember that each ShardedInteger represents a new time
+// series, which can dramatically increase the amount of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+func (reg *Register) Must3LabelShardedInteger(name, label1Name, label2Name, label3Name string) func(label1Value, label2Value, label3Value string) *ShardedInteger {
+	mustValidNames(name, label1Name, label2Name, label3Name)
+
+	order := sort3(&label1Name, &label2Name, &label3Name)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, shardedIntegerID).mustLabel(name, label1Name, label2Name, label3Name)
+
+	switch order {
+	case order123:
+		return l.shardedInteger123
+	case order132:
+		return l.shardedInteger132
+	case order213:
+		return l.shardedInteger213
+	case order231:
+		return l.shardedInteger231
+	case order312:
+		return l.shardedInteger312
+	case order321:
+		return l.shardedInteger321
+	default:
+		panic(order)
+	}
+}
+
 // Must1LabelCounterSample returns a function which registers a dedicated Sample
 // for each unique label combination. Multiple goroutines may invoke the
 // returned simultaneously. Remember that each Sample represents a new time
@@ -1005,6 +1543,101 @@ func (reg *Register) Must2LabelHistogram(name, label1Name, label2Name string, bu
 	return l.histogram12
 }
 
+// Must1LabelHistogramSample returns a function which registers a dedicated
+// HistogramSample for each unique label combination. Multiple goroutines may
+// invoke the returned simultaneously. Remember that each HistogramSample
+// represents a new time series, which can dramatically increase the amount
+// of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func Must1LabelHistogramSample(name, labelName string, buckets ...float64) func(labelValue string) *HistogramSample {
+	return std.Must1LabelHistogramSample(name, labelName, buckets...)
+}
+
+// Must1LabelHistogramSample returns a function which registers a dedicated
+// HistogramSample for each unique label combination. Multiple goroutines may
+// invoke the returned simultaneously. Remember that each HistogramSample
+// represents a new time series, which can dramatically increase the amount
+// of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) labelName does not match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) labelName is already in use.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func (reg *Register) Must1LabelHistogramSample(name, labelName string, buckets ...float64) func(labelValue string) *HistogramSample {
+	mustValidNames(name, labelName)
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, histogramSampleID).mustLabel(name, labelName, "", "")
+	l.buckets = buckets
+
+	return l.histogramSample1
+}
+
+// Must2LabelHistogramSample returns a function which registers a dedicated
+// HistogramSample for each unique label combination. Multiple goroutines may
+// invoke the returned simultaneously. Remember that each HistogramSample
+// represents a new time series, which can dramatically increase the amount
+// of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func Must2LabelHistogramSample(name, label1Name, label2Name string, buckets ...float64) func(label1Value, label2Value string) *HistogramSample {
+	return std.Must2LabelHistogramSample(name, label1Name, label2Name, buckets...)
+}
+
+// Must2LabelHistogramSample returns a function which registers a dedicated
+// HistogramSample for each unique label combination. Multiple goroutines may
+// invoke the returned simultaneously. Remember that each HistogramSample
+// represents a new time series, which can dramatically increase the amount
+// of data stored.
+//
+// Must panics on any of the following:
+// (1) name in use as another metric type,
+// (2) name doesn't match regular expression [a-zA-Z_:][a-zA-Z0-9_:]*,
+// (3) label names don't match regular expression [a-zA-Z_][a-zA-Z0-9_]* or
+// (4) label names are already in use.
+//
+// Buckets are defined as upper boundary values, with positive infinity
+// implied when absent. Any ∞ or not-a-number (NaN) value is ignored.
+func (reg *Register) Must2LabelHistogramSample(name, label1Name, label2Name string, buckets ...float64) func(label1Value, label2Value string) *HistogramSample {
+	mustValidNames(name, label1Name, label2Name)
+
+	var flip bool
+	if label1Name > label2Name {
+		label1Name, label2Name = label2Name, label1Name
+		flip = true
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	l := reg.mustGetOrCreateMetric(name, histogramSampleID).mustLabel(name, label1Name, label2Name, "")
+	l.buckets = buckets
+
+	if flip {
+		return l.histogramSample21
+	}
+	return l.histogramSample12
+}
+
 func mustValidNames(metricName string, labelNames ...string) {
 	mustValidMetricName(metricName)
 
@@ -1061,6 +1694,8 @@ func (reg *Register) MustHelp(name, text string) {
 		panic("metrics: name not in use")
 	}
 
+	m.help = text
+
 	// new-line characters are escaped in comments and label values
 	i := strings.Index(m.comments, "\n# HELP ")
 	if i >= 0 {
@@ -0,0 +1,39 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(buf []byte, field, wireType uint64) []byte {
+	return binary.AppendUvarint(buf, field<<3|wireType)
+}
+
+func appendVarintField(buf []byte, field, v uint64) []byte {
+	buf = appendTag(buf, field, wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendDoubleField(buf []byte, field uint64, f float64) []byte {
+	buf = appendTag(buf, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+func appendStringField(buf []byte, field uint64, s string) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBytesField(buf []byte, field uint64, p []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(p)))
+	return append(buf, p...)
+}
@@ -0,0 +1,317 @@
+// Package remotewrite provides metric exports with the Prometheus remote write
+// protocol (version 1). Protocol buffers and the snappy compression are
+// implemented in place to stay free of dependencies.
+package remotewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+	"github.com/pascaldekloe/metrics/internal/flatten"
+)
+
+// Defaults for the Client configuration.
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 30 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	DefaultQueueSize  = 16
+)
+
+// Client sends snapshots of a Register to a remote write endpoint. Payloads
+// which fail with a recoverable error, i.e., a network error, a 5xx status or
+// a 429 status, are queued for the next send. Multiple goroutines may invoke
+// methods on a Client simultaneously.
+type Client struct {
+	// URL is the remote write endpoint,
+	// e.g., "http://localhost:9090/api/v1/write".
+	URL string
+
+	// Header is added to each request, e.g., for Authorization.
+	Header http.Header
+
+	// HTTPClient is used for requests. The nil value defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Labels are added to each series, e.g., {"job": "backup"}. Series
+	// labels take precedence over these.
+	Labels map[string]string
+
+	// MaxRetries is the number of attempts after a recoverable failure,
+	// with exponential backoff from MinBackoff to MaxBackoff. Zero values
+	// default to DefaultMaxRetries, DefaultMinBackoff and DefaultMaxBackoff.
+	MaxRetries             int
+	MinBackoff, MaxBackoff time.Duration
+
+	// QueueSize limits the number of pending payloads. The oldest payload
+	// is dropped on overflow. The zero value defaults to DefaultQueueSize.
+	QueueSize int
+
+	reg *metrics.Register
+
+	mutex   sync.Mutex
+	queue   [][]byte // compressed payloads
+	sending bool     // queue in progress
+}
+
+// NewClient returns a new Client which sends the content of reg to url. A nil
+// reg defaults to the default register of the metrics package.
+func NewClient(reg *metrics.Register, url string) *Client {
+	return &Client{URL: url, reg: reg}
+}
+
+// Pending returns the number of payloads in queue.
+func (c *Client) Pending() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.queue)
+}
+
+// Send enqueues a snapshot, and then it sends each payload in queue, in order
+// of appearance. Live metrics get the timestamp of now. Samples keep their
+// capture timestamp. Payloads with an unrecoverable failure are dropped, and
+// their error is returned nonetheless. When another Send is in progress, then
+// the payload is left for that one, and Send returns nil without waiting.
+func (c *Client) Send() error {
+	var families []metrics.Family
+	if c.reg == nil {
+		families = metrics.Snapshot()
+	} else {
+		families = c.reg.Snapshot()
+	}
+	payload := snappyEncode(nil, appendWriteRequest(nil, families, c.Labels, time.Now()))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	queueSize := c.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	c.queue = append(c.queue, payload)
+	if len(c.queue) > queueSize {
+		c.queue = c.queue[len(c.queue)-queueSize:]
+	}
+
+	if c.sending {
+		return nil
+	}
+	c.sending = true
+	defer func() { c.sending = false }()
+
+	var firstErr error
+	for len(c.queue) != 0 {
+		payload := c.queue[0]
+		// no lock during (retries with) backoff
+		c.mutex.Unlock()
+		err := c.post(payload)
+		c.mutex.Lock()
+
+		var retry *recoverableError
+		if errors.As(err, &retry) {
+			return err // keep in queue
+		}
+		// payload may be dropped on overflow in the meantime
+		if len(c.queue) != 0 && &c.queue[0][0] == &payload[0] {
+			c.queue[0] = nil // GC
+			c.queue = c.queue[1:]
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.queue = nil // GC
+	return firstErr
+}
+
+// SendEvery sends a snapshot with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel.
+func (c *Client) SendEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		c.Send()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				c.Send()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// RecoverableError is worth a retry.
+type recoverableError struct{ err error }
+
+func (e *recoverableError) Error() string { return e.err.Error() }
+func (e *recoverableError) Unwrap() error { return e.err }
+
+// Post sends payload with retries on recoverable errors.
+func (c *Client) post(payload []byte) error {
+	maxRetries := c.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	backoff := c.MinBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	for retry := 0; ; retry++ {
+		err := c.postOnce(payload)
+		var r *recoverableError
+		if !errors.As(err, &r) || retry >= maxRetries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (c *Client) postOnce(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("remotewrite: %w", err)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &recoverableError{fmt.Errorf("remotewrite: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remotewrite: endpoint status %q: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return &recoverableError{err}
+	}
+	return err
+}
+
+// Metric types from the MetricMetadata enumeration.
+const (
+	metadataCounter   = 1
+	metadataGauge     = 2
+	metadataHistogram = 3
+	metadataSummary   = 5
+)
+
+// AppendWriteRequest appends a WriteRequest message in protocol buffers.
+func appendWriteRequest(buf []byte, families []metrics.Family, extra map[string]string, now time.Time) []byte {
+	nowMillis := now.UnixMilli()
+
+	var scratch []byte
+	var samples []flatten.Sample
+	for _, f := range families {
+		for i := range f.Series {
+			s := &f.Series[i]
+			timestamp := nowMillis
+			if s.Timestamp != 0 {
+				timestamp = int64(s.Timestamp)
+			}
+			labels := s.Labels
+			if len(extra) != 0 {
+				labels = make(map[string]string, len(extra)+len(s.Labels))
+				for k, v := range extra {
+					labels[k] = v
+				}
+				for k, v := range s.Labels {
+					labels[k] = v
+				}
+			}
+
+			samples = flatten.AppendSamples(samples[:0], f.Type, s)
+			for _, sample := range samples {
+				scratch = appendTimeSeries(scratch[:0], f.Name+sample.Suffix, sample.Labels(labels), sample.Value, timestamp)
+				buf = appendBytesField(buf, 1, scratch)
+			}
+		}
+	}
+
+	for _, f := range families {
+		var metricType uint64
+		switch f.Type {
+		case "counter":
+			metricType = metadataCounter
+		case "histogram":
+			metricType = metadataHistogram
+		case "summary":
+			metricType = metadataSummary
+		default:
+			metricType = metadataGauge
+		}
+
+		scratch = appendVarintField(scratch[:0], 1, metricType)
+		scratch = appendStringField(scratch, 2, f.Name)
+		if f.Help != "" {
+			scratch = appendStringField(scratch, 4, f.Help)
+		}
+		buf = appendBytesField(buf, 3, scratch)
+	}
+
+	return buf
+}
+
+// AppendTimeSeries appends a TimeSeries message with one sample.
+func appendTimeSeries(buf []byte, name string, labels map[string]string, value float64, timestamp int64) []byte {
+	// labels must be sorted by name, including the metric name
+	labelNames := make([]string, 0, len(labels)+1)
+	labelNames = append(labelNames, "__name__")
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+
+	var label []byte
+	for _, labelName := range labelNames {
+		labelValue := labels[labelName]
+		if labelName == "__name__" {
+			labelValue = name
+		}
+		label = appendStringField(label[:0], 1, labelName)
+		label = appendStringField(label, 2, labelValue)
+		buf = appendBytesField(buf, 1, label)
+	}
+
+	var sample []byte
+	sample = appendDoubleField(sample, 1, value)
+	sample = appendVarintField(sample, 2, uint64(timestamp))
+	return appendBytesField(buf, 2, sample)
+}
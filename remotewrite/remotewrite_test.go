@@ -0,0 +1,390 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestSnappyRoundtrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(42)).Read(random)
+	golden := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("abcd"),
+		bytes.Repeat([]byte("a"), 1000),
+		bytes.Repeat([]byte("metrics_"), 10000),
+		random,
+	}
+	for _, src := range golden {
+		got, err := snappyDecode(snappyEncode(nil, src))
+		if err != nil {
+			t.Errorf("decode error for %d bytes: %s", len(src), err)
+			continue
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("roundtrip of %d bytes got %d bytes", len(src), len(got))
+		}
+	}
+
+	if src := bytes.Repeat([]byte("metrics_"), 10000); len(snappyEncode(nil, src)) > len(src)/10 {
+		t.Error("no compression of repetitive content")
+	}
+}
+
+// SnappyDecode is a reference implementation of the block format.
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("malformed length")
+	}
+	src = src[n:]
+	var dst []byte
+	for len(src) != 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			n := int(tag >> 2)
+			src = src[1:]
+			if n >= 60 {
+				extra := n - 59
+				n = 0
+				for i := extra - 1; i >= 0; i-- {
+					n = n<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			n++
+			if n > len(src) {
+				return nil, errors.New("literal exceeds input")
+			}
+			dst = append(dst, src[:n]...)
+			src = src[n:]
+			continue
+		case 1:
+			length := 4 + int(tag>>2&7)
+			offset := int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+			dst = appendBackref(dst, offset, length)
+		case 2:
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			dst = appendBackref(dst, offset, length)
+		case 3:
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			dst = appendBackref(dst, offset, length)
+		}
+		if dst == nil {
+			return nil, errors.New("copy offset out of bounds")
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("got %d bytes, want %d", len(dst), size)
+	}
+	return dst, nil
+}
+
+func appendBackref(dst []byte, offset, length int) []byte {
+	if offset <= 0 || offset > len(dst) {
+		return nil
+	}
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[len(dst)-offset])
+	}
+	return dst
+}
+
+// Series is a decoded TimeSeries with one sample.
+type series struct {
+	Labels    string // Prometheus notation
+	Value     float64
+	Timestamp int64
+}
+
+// DecodeWriteRequest returns the time series, plus the metadata as
+// "<type> <name> <help>" entries.
+func decodeWriteRequest(p []byte) ([]series, []string, error) {
+	var all []series
+	var metadata []string
+	err := walkFields(p, func(field uint64, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			var s series
+			var labels []string
+			err := walkFields(b, func(field uint64, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					var name, value string
+					walkFields(b, func(field uint64, _ uint64, b []byte) error {
+						if field == 1 {
+							name = string(b)
+						} else {
+							value = string(b)
+						}
+						return nil
+					})
+					labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+				case 2:
+					walkFields(b, func(field uint64, v uint64, _ []byte) error {
+						if field == 1 {
+							s.Value = math.Float64frombits(v)
+						} else {
+							s.Timestamp = int64(v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			s.Labels = "{" + strings.Join(labels, ",") + "}"
+			all = append(all, s)
+			return err
+		case 3:
+			var typ uint64
+			var name, help string
+			err := walkFields(b, func(field uint64, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					typ = v
+				case 2:
+					name = string(b)
+				case 4:
+					help = string(b)
+				}
+				return nil
+			})
+			metadata = append(metadata, fmt.Sprintf("%d %s %s", typ, name, help))
+			return err
+		}
+		return nil
+	})
+	return all, metadata, err
+}
+
+// WalkFields calls f for each field, with either the varint, the fixed64 or
+// the bytes content.
+func walkFields(p []byte, f func(field, v uint64, b []byte) error) error {
+	for len(p) != 0 {
+		key, n := binary.Uvarint(p)
+		if n <= 0 {
+			return errors.New("malformed field key")
+		}
+		p = p[n:]
+
+		var v uint64
+		var b []byte
+		switch key & 7 {
+		case wireVarint:
+			v, n = binary.Uvarint(p)
+			if n <= 0 {
+				return errors.New("malformed varint")
+			}
+			p = p[n:]
+		case wireFixed64:
+			if len(p) < 8 {
+				return errors.New("fixed64 exceeds input")
+			}
+			v = binary.LittleEndian.Uint64(p)
+			p = p[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(p)
+			if n <= 0 || uint64(len(p)-n) < size {
+				return errors.New("malformed length-delimited")
+			}
+			b = p[n : n+int(size)]
+			p = p[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		if err := f(key>>3, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.Must1LabelCounter("jobs_total", "status")("ok").Add(7)
+	reg.MustHelp("jobs_total", "Jobs processed.")
+	reg.MustRealSample("duration_seconds", "").Set(1.5, time.UnixMilli(1615130567389))
+	reg.MustHistogram("size_bytes", "", 100).Add(50)
+
+	var gotSeries []series
+	var gotMetadata []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "snappy" {
+			t.Errorf("got Content-Encoding %q, want snappy", got)
+		}
+		if got := r.Header.Get("X-Prometheus-Remote-Write-Version"); got != "0.1.0" {
+			t.Errorf("got X-Prometheus-Remote-Write-Version %q, want 0.1.0", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		p, err := snappyDecode(body)
+		if err != nil {
+			t.Error("snappy decode error:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotSeries, gotMetadata, err = decodeWriteRequest(p)
+		if err != nil {
+			t.Error("protobuf decode error:", err)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(reg, srv.URL)
+	c.Labels = map[string]string{"job": "batch", "status": "overridden"}
+	if err := c.Send(); err != nil {
+		t.Fatal("send error:", err)
+	}
+
+	ts := gotSeries[0].Timestamp // now
+	want := []series{
+		{`{__name__="jobs_total",job="batch",status="ok"}`, 7, ts},
+		{`{__name__="duration_seconds",job="batch",status="overridden"}`, 1.5, 1615130567389},
+		{`{__name__="size_bytes_bucket",job="batch",le="100",status="overridden"}`, 1, ts},
+		{`{__name__="size_bytes_bucket",job="batch",le="+Inf",status="overridden"}`, 1, ts},
+		{`{__name__="size_bytes_count",job="batch",status="overridden"}`, 1, ts},
+		{`{__name__="size_bytes_sum",job="batch",status="overridden"}`, 50, ts},
+	}
+	if !reflect.DeepEqual(gotSeries, want) {
+		t.Errorf("got series %+v", gotSeries)
+		t.Errorf("want %+v", want)
+	}
+	if d := time.Since(time.UnixMilli(ts)); d < 0 || d > time.Minute {
+		t.Errorf("got timestamp %d for live metrics, want now", ts)
+	}
+	wantMetadata := []string{"1 jobs_total Jobs processed.", "2 duration_seconds ", "3 size_bytes "}
+	if !reflect.DeepEqual(gotMetadata, wantMetadata) {
+		t.Errorf("got metadata %q, want %q", gotMetadata, wantMetadata)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	var failures, requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failures.Load() > 0 {
+			failures.Add(-1)
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(metrics.NewRegister(), srv.URL)
+	c.MinBackoff = time.Millisecond
+	c.MaxRetries = 2
+
+	// recover within retries
+	failures.Store(2)
+	if err := c.Send(); err != nil {
+		t.Fatal("send error:", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+
+	// exceed retries
+	failures.Store(3)
+	if err := c.Send(); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("got error %v, want status 503", err)
+	}
+	if got := c.Pending(); got != 1 {
+		t.Errorf("got %d pending payloads, want 1", got)
+	}
+
+	// queue flushes with next send
+	requests.Store(0)
+	if err := c.Send(); err != nil {
+		t.Fatal("send error:", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if got := c.Pending(); got != 0 {
+		t.Errorf("got %d pending payloads, want 0", got)
+	}
+}
+
+func TestSendUnrecoverable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := NewClient(metrics.NewRegister(), srv.URL)
+	if err := c.Send(); err == nil || !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("got error %v, want status 400", err)
+	}
+	if got := c.Pending(); got != 0 {
+		t.Errorf("got %d pending payloads, want drop", got)
+	}
+}
+
+func TestLabelOrder(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.Must2LabelCounter("c", "A", "z")("1", "2").Add(1)
+	gotSeries, _, err := decodeWriteRequest(appendWriteRequest(nil, reg.Snapshot(), nil, time.Now()))
+	if err != nil {
+		t.Fatal("protobuf decode error:", err)
+	}
+	if want := `{A="1",__name__="c",z="2"}`; len(gotSeries) != 1 || gotSeries[0].Labels != want {
+		t.Errorf("got series %+v, want labels %s", gotSeries, want)
+	}
+}
+
+func TestSendConcurrent(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			arrived <- struct{}{}
+			<-release
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(metrics.NewRegister(), srv.URL)
+	done := make(chan error)
+	go func() { done <- c.Send() }()
+	<-arrived
+
+	// no wait on the send in progress
+	if err := c.Send(); err != nil {
+		t.Error("concurrent send error:", err)
+	}
+	if got := c.Pending(); got != 2 {
+		t.Errorf("got %d pending payloads, want 2", got)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Error("send error:", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if got := c.Pending(); got != 0 {
+		t.Errorf("got %d pending payloads, want 0", got)
+	}
+}
@@ -0,0 +1,74 @@
+package remotewrite
+
+import "encoding/binary"
+
+// Snappy element types
+const (
+	tagLiteral = 0
+	tagCopy2   = 2
+)
+
+// SnappyEncode appends the block format (not the framing format) of src.
+// Matches are found with a hash table on 4-byte sequences, within a 64 KiB
+// window.
+func snappyEncode(dst, src []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+
+	const tableBits = 14
+	var table [1 << tableBits]int32 // offset + 1; zero for none
+
+	literalStart := 0
+	for i := 0; i+4 <= len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 0x1e35a7bd) >> (32 - tableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > 0xffff || binary.LittleEndian.Uint32(src[candidate:]) != seq {
+			i++
+			continue
+		}
+
+		dst = appendLiteral(dst, src[literalStart:i])
+		n := 4
+		for i+n < len(src) && src[candidate+n] == src[i+n] {
+			n++
+		}
+		dst = appendCopy(dst, i-candidate, n)
+		i += n
+		literalStart = i
+	}
+	return appendLiteral(dst, src[literalStart:])
+}
+
+func appendLiteral(dst, lit []byte) []byte {
+	n := len(lit) - 1
+	switch {
+	case n < 0:
+		return dst
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// AppendCopy emits copies with a 2-byte offset, for up to 64 bytes each.
+func appendCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		dst = append(dst, byte(n-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
@@ -0,0 +1,229 @@
+// Package runtimestat provides Go statistics from the runtime/metrics package.
+//
+// Unlike runtime.ReadMemStats, as used by package gostat, the readings don't
+// stop the world. Names follow the conversion of the standard client, such
+// that "/gc/heap/allocs:bytes" becomes "go_gc_heap_allocs_bytes_total". See
+// the collectors.WithGoCollectorRuntimeMetrics documentation for details.
+package runtimestat
+
+import (
+	"math"
+	"regexp"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	root "github.com/pascaldekloe/metrics"
+)
+
+// Rule selects runtime metrics by name, e.g., "/gc/pauses:seconds".
+type Rule struct {
+	Matcher *regexp.Regexp
+}
+
+// Predefined Rules
+var (
+	MetricsAll       = Rule{regexp.MustCompile(`^/.*`)}
+	MetricsGC        = Rule{regexp.MustCompile(`^/gc/.*`)}
+	MetricsMemory    = Rule{regexp.MustCompile(`^/memory/.*`)}
+	MetricsScheduler = Rule{regexp.MustCompile(`^/sched/.*`)}
+)
+
+// Collector reads a selection of runtime metrics. Multiple goroutines may
+// invoke methods on a Collector simultaneously.
+type Collector struct {
+	mutex sync.Mutex
+
+	// argument for metrics.Read
+	readings []metrics.Sample
+
+	// destination for each reading
+	samples    []*root.Sample // nil for histograms
+	histograms []*histogram   // nil for scalars
+}
+
+// Histogram bridges a metrics.Float64Histogram with a HistogramSample.
+type histogram struct {
+	*root.HistogramSample
+	// representative value for each runtime bucket
+	values []float64
+	// HistogramSample bucket index for each runtime bucket
+	indices []int
+	// reusable argument for HistogramSample.Set
+	buckets []uint64
+}
+
+// New registers each runtime metric which matches any of the rules on reg.
+// All supported metrics are included when no rules are given. Registration
+// panics on name conflicts.
+//
+// Histograms are rebucketed to an exponential subset of the runtime bounds,
+// with a factor of two at least. The sum of observations is an approximation,
+// as it is derived from the bucket bounds.
+func New(reg *root.Register, rules ...Rule) *Collector {
+	if len(rules) == 0 {
+		rules = []Rule{MetricsAll}
+	}
+
+	c := new(Collector)
+	for _, d := range metrics.All() {
+		if !anyMatch(rules, d.Name) {
+			continue
+		}
+
+		name := promName(d)
+		switch d.Kind {
+		case metrics.KindUint64, metrics.KindFloat64:
+			var s *root.Sample
+			if d.Cumulative {
+				s = reg.MustCounterSample(name, d.Description)
+			} else {
+				s = reg.MustRealSample(name, d.Description)
+			}
+			c.readings = append(c.readings, metrics.Sample{Name: d.Name})
+			c.samples = append(c.samples, s)
+			c.histograms = append(c.histograms, nil)
+
+		case metrics.KindFloat64Histogram:
+			reading := []metrics.Sample{{Name: d.Name}}
+			metrics.Read(reading)
+			if reading[0].Value.Kind() != metrics.KindFloat64Histogram {
+				continue // not supported
+			}
+			bounds := reading[0].Value.Float64Histogram().Buckets
+
+			h := &histogram{
+				HistogramSample: reg.MustHistogramSample(name, d.Description, rebucket(bounds)...),
+				values:          representatives(bounds),
+			}
+			for _, v := range h.values {
+				h.indices = append(h.indices, sort.SearchFloat64s(h.BucketBounds, v))
+			}
+			h.buckets = make([]uint64, len(h.BucketBounds))
+			c.readings = append(c.readings, metrics.Sample{Name: d.Name})
+			c.samples = append(c.samples, nil)
+			c.histograms = append(c.histograms, h)
+		}
+	}
+
+	return c
+}
+
+func anyMatch(rules []Rule, name string) bool {
+	for _, r := range rules {
+		if r.Matcher.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PromName returns the Prometheus equivalent of a runtime metric name.
+func promName(d metrics.Description) string {
+	path, unit, _ := strings.Cut(d.Name, ":")
+	name := "go" + strings.ReplaceAll(path, "/", "_") + "_" + unit
+	if d.Cumulative && d.Kind != metrics.KindFloat64Histogram {
+		name += "_total"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Rebucket returns an exponential subset of the runtime bounds.
+func rebucket(bounds []float64) []float64 {
+	var a []float64
+	for _, f := range bounds {
+		if math.IsInf(f, 0) {
+			continue
+		}
+		if len(a) == 0 || a[len(a)-1] <= 0 || f >= 2*a[len(a)-1] {
+			a = append(a, f)
+		}
+	}
+	return a
+}
+
+// Representatives returns a value for each runtime bucket, such that each
+// falls into the rebucketed equivalent.
+func representatives(bounds []float64) []float64 {
+	values := make([]float64, len(bounds)-1)
+	for i := range values {
+		low, high := bounds[i], bounds[i+1]
+		switch {
+		case math.IsInf(low, -1):
+			values[i] = high
+		case math.IsInf(high, 1):
+			values[i] = math.Nextafter(low, high)
+		default:
+			values[i] = low + (high-low)/2
+		}
+	}
+	return values
+}
+
+// Capture updates the metrics.
+func (c *Collector) Capture() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	metrics.Read(c.readings)
+	timestamp := time.Now()
+
+	for i, reading := range c.readings {
+		switch reading.Value.Kind() {
+		case metrics.KindUint64:
+			c.samples[i].Set(float64(reading.Value.Uint64()), timestamp)
+		case metrics.KindFloat64:
+			c.samples[i].Set(reading.Value.Float64(), timestamp)
+		case metrics.KindFloat64Histogram:
+			h := c.histograms[i]
+			for j := range h.buckets {
+				h.buckets[j] = 0
+			}
+			var count uint64
+			var sum float64
+			for j, n := range reading.Value.Float64Histogram().Counts {
+				if j >= len(h.indices) {
+					break // runtime bounds changed
+				}
+				if index := h.indices[j]; index < len(h.buckets) {
+					h.buckets[index] += n
+				}
+				count += n
+				sum += h.values[j] * float64(n)
+			}
+			h.Set(h.buckets, count, sum, timestamp)
+		}
+	}
+}
+
+// CaptureEvery updates the metrics with an interval, starting now.
+// The routine terminates with a send or close on cancel.
+func (c *Collector) CaptureEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		c.Capture()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				c.Capture()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
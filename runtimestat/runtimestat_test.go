@@ -0,0 +1,117 @@
+package runtimestat
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+
+	root "github.com/pascaldekloe/metrics"
+)
+
+func TestCapture(t *testing.T) {
+	reg := root.NewRegister()
+	c := New(reg, MetricsScheduler, Rule{regexp.MustCompile("^/gc/heap/allocs:bytes$")})
+	runtime.GC()
+	c.Capture()
+	c.Capture() // delta
+
+	root.SkipTimestamp = true
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	got := buf.String()
+
+	for _, want := range []string{
+		"\n# TYPE go_sched_goroutines_goroutines gauge\n",
+		"\n# TYPE go_sched_latencies_seconds histogram\n",
+		"\n# TYPE go_gc_heap_allocs_bytes_total counter\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(got, "go_memory_") {
+		t.Error("got memory metrics while not included")
+	}
+
+	for i, reading := range c.readings {
+		if reading.Name != "/sched/latencies:seconds" {
+			continue
+		}
+		var want uint64
+		for _, n := range reading.Value.Float64Histogram().Counts {
+			want += n
+		}
+		_, count, _, _ := c.histograms[i].Get(nil)
+		if count != want {
+			t.Errorf("scheduler latencies got count %d, want %d", count, want)
+		}
+	}
+}
+
+func TestPromName(t *testing.T) {
+	golden := []struct {
+		d    metrics.Description
+		want string
+	}{
+		{metrics.Description{Name: "/gc/heap/allocs:bytes", Kind: metrics.KindUint64, Cumulative: true}, "go_gc_heap_allocs_bytes_total"},
+		{metrics.Description{Name: "/sched/goroutines:goroutines", Kind: metrics.KindUint64}, "go_sched_goroutines_goroutines"},
+		{metrics.Description{Name: "/gc/pauses:seconds", Kind: metrics.KindFloat64Histogram, Cumulative: true}, "go_gc_pauses_seconds"},
+		{metrics.Description{Name: "/cpu/classes/gc/mark/assist:cpu-seconds", Kind: metrics.KindFloat64, Cumulative: true}, "go_cpu_classes_gc_mark_assist_cpu_seconds_total"},
+	}
+	for _, gold := range golden {
+		if got := promName(gold.d); got != gold.want {
+			t.Errorf("%q got %q, want %q", gold.d.Name, got, gold.want)
+		}
+	}
+}
+
+func TestRebucket(t *testing.T) {
+	inf := math.Inf(1)
+	bounds := []float64{-inf, 0, 1, 1.5, 2, 3, 4, 7, 8, 9, 20, inf}
+
+	got := rebucket(bounds)
+	want := []float64{0, 1, 2, 4, 8, 20}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got bounds %v, want %v", got, want)
+	}
+
+	// each representative must land in the bucket of its high bound
+	h := root.NewRegister().MustHistogram("h", "", got...)
+	for i, v := range representatives(bounds) {
+		h.Add(v)
+		buckets, _, _ := h.Get(nil)
+		var hit int
+		for hit = range buckets {
+			if buckets[hit] != 0 {
+				break
+			}
+		}
+		if buckets[hit] == 0 {
+			hit = len(buckets) // +Inf
+		}
+		wantHit := len(got)
+		for j, f := range got {
+			if f >= bounds[i+1] {
+				wantHit = j
+				break
+			}
+		}
+		if hit != wantHit {
+			t.Errorf("runtime bucket [%g, %g) got bucket index %d, want %d", bounds[i], bounds[i+1], hit, wantHit)
+		}
+		h = root.NewRegister().MustHistogram("h", "", got...)
+	}
+}
+
+func TestNewAll(t *testing.T) {
+	c := New(root.NewRegister())
+	if len(c.readings) == 0 {
+		t.Fatal("no metrics registered")
+	}
+	c.Capture()
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Shards are padded to prevent false sharing of CPU cache lines, like the
+// histogram buckets are.
+const shardPadding = 16
+
+// ShardCount is a power of two, with at least one shard per CPU.
+func shardCount() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) && n < 256 {
+		n <<= 1
+	}
+	return n
+}
+
+// ShardIndex returns a shard for the current goroutine, by means of its stack
+// address. Goroutines keep using the same shard, unless their stack moves.
+func shardIndex(mask int) int {
+	var anchor byte
+	addr := uint64(uintptr(unsafe.Pointer(&anchor)))
+	// stacks are at least 2 KiB apart; mix with the golden ratio
+	return int((addr>>11)*0x9e3779b97f4a7c15>>40) & mask
+}
+
+// ShardedCounter is a Counter which spreads its increments over multiple
+// shards, to reduce contention from many goroutines. Reads sum all shards,
+// which makes them slower than with a Counter. The default/initial value is
+// zero.
+// Multiple goroutines may invoke methods on a ShardedCounter simultaneously.
+type ShardedCounter struct {
+	shards []atomic.Uint64 // with padding
+	mask   int             // shard count minus one
+	// fixed start of serial line is <name> <label-map>? ' '
+	prefix string
+}
+
+func newShardedCounter(prefix string) *ShardedCounter {
+	n := shardCount()
+	return &ShardedCounter{
+		shards: make([]atomic.Uint64, n*shardPadding),
+		mask:   n - 1,
+		prefix: prefix,
+	}
+}
+
+// ShardedInteger is an Integer which spreads its updates over multiple
+// shards, to reduce contention from many goroutines. Reads sum all shards,
+// which makes them slower than with an Integer. The default/initial value is
+// zero.
+// Multiple goroutines may invoke methods on a ShardedInteger simultaneously.
+type ShardedInteger struct {
+	shards []atomic.Int64 // with padding
+	mask   int            // shard count minus one
+	// fixed start of serial line is <name> <label-map>? ' '
+	prefix string
+}
+
+func newShardedInteger(prefix string) *ShardedInteger {
+	n := shardCount()
+	return &ShardedInteger{
+		shards: make([]atomic.Int64, n*shardPadding),
+		mask:   n - 1,
+		prefix: prefix,
+	}
+}
+
+// Name returns the metric identifier.
+func (m *ShardedCounter) Name() string { return parseMetricName(m.prefix) }
+
+// Name returns the metric identifier.
+func (m *ShardedInteger) Name() string { return parseMetricName(m.prefix) }
+
+// Labels returns a new map if m has labels.
+func (m *ShardedCounter) Labels() map[string]string { return parseMetricLabels(m.prefix) }
+
+// Labels returns a new map if m has labels.
+func (m *ShardedInteger) Labels() map[string]string { return parseMetricLabels(m.prefix) }
+
+// Get returns the current value, as the sum of all shards.
+func (m *ShardedCounter) Get() uint64 {
+	var sum uint64
+	for i := 0; i < len(m.shards); i += shardPadding {
+		sum += m.shards[i].Load()
+	}
+	return sum
+}
+
+// Get returns the current value, as the sum of all shards.
+func (m *ShardedInteger) Get() int64 {
+	var sum int64
+	for i := 0; i < len(m.shards); i += shardPadding {
+		sum += m.shards[i].Load()
+	}
+	return sum
+}
+
+// Add increments the current value with n.
+func (m *ShardedCounter) Add(n uint64) {
+	m.shards[shardIndex(m.mask)*shardPadding].Add(n)
+}
+
+// Add sums the current value with n.
+func (m *ShardedInteger) Add(n int64) {
+	m.shards[shardIndex(m.mask)*shardPadding].Add(n)
+}
+
+// Set defines the current value, as an Add of the difference with Get. Any
+// concurrent Add applies either before or after Set. Concurrent invocations
+// of Set may add up, as opposed to the last one winning.
+func (m *ShardedInteger) Set(update int64) {
+	m.Add(update - m.Get())
+}
@@ -0,0 +1,95 @@
+package metrics_test
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestSharded(t *testing.T) {
+	metrics.SkipTimestamp = true
+	reg := metrics.NewRegister()
+	c := reg.MustShardedCounter("requests_total", "")
+	i := reg.Must1LabelShardedInteger("in_flight", "route")("/")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				c.Add(1)
+				i.Add(2)
+				i.Add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := c.Get(); got != 64000 {
+		t.Errorf("got counter %d, want 64000", got)
+	}
+	if got := i.Get(); got != 64000 {
+		t.Errorf("got integer %d, want 64000", got)
+	}
+	i.Set(-7)
+	if got := i.Get(); got != -7 {
+		t.Errorf("got integer %d after Set(-7)", got)
+	}
+
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	const want = `# Prometheus Samples
+
+# TYPE requests_total counter
+requests_total 64000
+
+# TYPE in_flight gauge
+in_flight{route="/"} -7
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func BenchmarkAddContended(b *testing.B) {
+	for _, routines := range []int{8, 64} {
+		name := strconv.Itoa(routines) + "routines"
+
+		b.Run("counter/"+name, func(b *testing.B) {
+			m := metrics.NewRegister().MustCounter("bench_counter_unit", "")
+			runContended(b, routines, func() { m.Add(1) })
+		})
+		b.Run("sharded-counter/"+name, func(b *testing.B) {
+			m := metrics.NewRegister().MustShardedCounter("bench_counter_unit", "")
+			runContended(b, routines, func() { m.Add(1) })
+		})
+		b.Run("integer/"+name, func(b *testing.B) {
+			m := metrics.NewRegister().MustInteger("bench_gauge_unit", "")
+			runContended(b, routines, func() { m.Add(1) })
+		})
+		b.Run("sharded-integer/"+name, func(b *testing.B) {
+			m := metrics.NewRegister().MustShardedInteger("bench_gauge_unit", "")
+			runContended(b, routines, func() { m.Add(1) })
+		})
+	}
+}
+
+// RunContended spreads b.N invocations of f over a number of goroutines.
+func runContended(b *testing.B, routines int, f func()) {
+	done := make(chan struct{})
+	for r := 0; r < routines; r++ {
+		go func() {
+			for i := b.N / routines; i >= 0; i-- {
+				f()
+			}
+			done <- struct{}{}
+		}()
+	}
+	for r := 0; r < routines; r++ {
+		<-done
+	}
+}
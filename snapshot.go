@@ -0,0 +1,298 @@
+package metrics
+
+// Family is a snapshot of a metric, with each of its time series.
+type Family struct {
+	Name string
+	Help string // optional
+	// Type is either "counter", "gauge", "histogram" or "summary".
+	Type string
+
+	Series []Series
+}
+
+// Series is a snapshot of a single time series.
+type Series struct {
+	// Labels is nil when the series has no labels.
+	Labels map[string]string
+
+	// Timestamp is the capture moment of samples in Unix time in
+	// milliseconds. Live metrics have a zero timestamp.
+	Timestamp uint64
+
+	// Value is the reading of counters and gauges.
+	Value float64
+
+	// BucketBounds and Buckets are set for histograms only. Buckets has the
+	// observation count for each BucketBounds, not cumulative, and with the
+	// positive infinity bucket omitted, i.e., Count minus the Buckets sum.
+	BucketBounds []float64
+	Buckets      []uint64
+
+	// Quantiles and QuantileValues are set for summaries only.
+	Quantiles      []float64
+	QuantileValues []float64
+
+	// Count and Sum are of the observations in histograms and summaries.
+	Count uint64
+	Sum   float64
+}
+
+// Snapshot returns the current state of each metric in order of appearance.
+// Samples without any capture (i.e., zero timestamp) are omitted, just like
+// they are with serialisation.
+func Snapshot() []Family {
+	return std.Snapshot()
+}
+
+// Snapshot returns the current state of each metric in order of appearance.
+// Samples without any capture (i.e., zero timestamp) are omitted, just like
+// they are with serialisation.
+func (reg *Register) Snapshot() []Family {
+	return reg.snapshot(nil)
+}
+
+// Snapshot returns the current state of each metric with a name accepted by
+// filter. A nil filter accepts all names.
+func (reg *Register) snapshot(filter func(name string) bool) []Family {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	selection := reg.selection(filter)
+	families := make([]Family, len(selection))
+	for i, m := range selection {
+		families[i] = m.snapshot()
+	}
+	return families
+}
+
+// Selection returns each metric with a name accepted by filter, in order of
+// appearance. A nil filter accepts all names. The read lock must be held.
+func (reg *Register) selection(filter func(name string) bool) []*metric {
+	if filter == nil {
+		return reg.metrics
+	}
+
+	skip := make([]bool, len(reg.metrics))
+	for name, index := range reg.indices {
+		skip[index] = !filter(name)
+	}
+	selection := make([]*metric, 0, len(reg.metrics))
+	for i, m := range reg.metrics {
+		if !skip[i] {
+			selection = append(selection, m)
+		}
+	}
+	return selection
+}
+
+func (m *metric) snapshot() Family {
+	f := Family{Name: m.name, Help: m.help, Type: typeName(m.typeID)}
+	for _, v := range m.appendInstances(nil) {
+		f.Series = v.appendSeries(f.Series)
+	}
+	return f
+}
+
+// Instance is a metric with its labels, if any. Both the text serialisation
+// and Snapshot use the same instances.
+type instance interface {
+	// Append serialises in the text format, with timestamps unless skipped.
+	append(buf []byte, skipTimestamp bool) []byte
+	// AppendSeries adds the Snapshot representation, if any.
+	appendSeries(a []Series) []Series
+}
+
+// AppendInstances adds each instance of m to a, in order of appearance.
+func (m *metric) appendInstances(a []instance) []instance {
+	switch m.typeID {
+	case counterID:
+		if m.counter != nil {
+			a = append(a, m.counter)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.counters {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case integerID:
+		if m.integer != nil {
+			a = append(a, m.integer)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.integers {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case realID:
+		if m.real != nil {
+			a = append(a, m.real)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.reals {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case realCounterID:
+		if m.realCounter != nil {
+			a = append(a, m.realCounter)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.realCounters {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case shardedCounterID:
+		if m.shardedCounter != nil {
+			a = append(a, m.shardedCounter)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.shardedCounters {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case shardedIntegerID:
+		if m.shardedInteger != nil {
+			a = append(a, m.shardedInteger)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.shardedIntegers {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case counterSampleID, realSampleID:
+		if m.sample != nil {
+			a = append(a, m.sample)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.samples {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case histogramID:
+		if m.histogram != nil {
+			a = append(a, m.histogram)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.histograms {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case histogramSampleID:
+		if m.histogramSample != nil {
+			a = append(a, m.histogramSample)
+		}
+		for _, l := range m.labels {
+			l.Lock()
+			for _, v := range l.histogramSamples {
+				a = append(a, v)
+			}
+			l.Unlock()
+		}
+
+	case summarySampleID:
+		if m.summary != nil {
+			a = append(a, m.summary)
+		}
+	}
+	return a
+}
+
+func (m *Counter) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: float64(m.Get())})
+}
+
+func (m *Integer) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: float64(m.Get())})
+}
+
+func (m *Real) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: m.Get()})
+}
+
+func (m *RealCounter) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: m.Get()})
+}
+
+func (m *ShardedCounter) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: float64(m.Get())})
+}
+
+func (m *ShardedInteger) appendSeries(a []Series) []Series {
+	return append(a, Series{Labels: m.Labels(), Value: float64(m.Get())})
+}
+
+func (m *Histogram) appendSeries(a []Series) []Series {
+	buckets, count, sum, err := m.GetRecent(make([]uint64, 0, len(m.BucketBounds)), HistogramMaxAge, HistogramMaxWait)
+	if err != nil {
+		return a // omit stall
+	}
+	return append(a, Series{
+		Labels:       m.Labels(),
+		BucketBounds: m.BucketBounds,
+		Buckets:      buckets,
+		Count:        count,
+		Sum:          sum,
+	})
+}
+
+func (m *Sample) appendSeries(a []Series) []Series {
+	value, timestamp := m.Get()
+	if timestamp == 0 {
+		return a
+	}
+	return append(a, Series{Labels: m.Labels(), Timestamp: timestamp, Value: value})
+}
+
+func (m *HistogramSample) appendSeries(a []Series) []Series {
+	buckets, count, sum, timestamp := m.Get(make([]uint64, 0, len(m.BucketBounds)))
+	if timestamp == 0 {
+		return a
+	}
+	return append(a, Series{
+		Labels:       m.Labels(),
+		Timestamp:    timestamp,
+		BucketBounds: m.BucketBounds,
+		Buckets:      buckets,
+		Count:        count,
+		Sum:          sum,
+	})
+}
+
+func (m *SummarySample) appendSeries(a []Series) []Series {
+	values, count, sum, timestamp := m.Get(make([]float64, 0, len(m.Quantiles)))
+	if timestamp == 0 {
+		return a
+	}
+	return append(a, Series{
+		Labels:         m.Labels(),
+		Timestamp:      timestamp,
+		Quantiles:      m.Quantiles,
+		QuantileValues: values,
+		Count:          count,
+		Sum:            sum,
+	})
+}
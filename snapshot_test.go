@@ -0,0 +1,41 @@
+package metrics_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func TestSnapshot(t *testing.T) {
+	reg := metrics.NewRegister()
+	reg.MustCounter("c", "counts").Add(2)
+	reg.Must1LabelInteger("i", "l")("v").Set(-3)
+	reg.MustRealSample("s", "") // no capture
+	reg.MustHelp("i", "labeled")
+	h := reg.MustHistogram("h", "", 1, 2)
+	h.Add(1.5)
+	h.Add(3)
+	reg.MustSummarySample("q", "", 0.5).Set([]float64{0.25}, 4, 1, time.UnixMilli(1615130567389))
+
+	want := []metrics.Family{
+		{Name: "c", Help: "counts", Type: "counter", Series: []metrics.Series{
+			{Value: 2},
+		}},
+		{Name: "i", Help: "labeled", Type: "gauge", Series: []metrics.Series{
+			{Labels: map[string]string{"l": "v"}, Value: -3},
+		}},
+		{Name: "s", Type: "gauge"},
+		{Name: "h", Type: "histogram", Series: []metrics.Series{
+			{BucketBounds: []float64{1, 2}, Buckets: []uint64{0, 1}, Count: 2, Sum: 4.5},
+		}},
+		{Name: "q", Type: "summary", Series: []metrics.Series{
+			{Timestamp: 1615130567389, Quantiles: []float64{0.5}, QuantileValues: []float64{0.25}, Count: 4, Sum: 1},
+		}},
+	}
+	if got := reg.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v", got)
+		t.Errorf("want %+v", want)
+	}
+}
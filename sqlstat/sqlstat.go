@@ -0,0 +1,86 @@
+// Package sqlstat provides database/sql statistics to the default registry.
+//
+// The bindings are equivalent to the standard client implementation, except
+// for the label name "db". See the collectors.NewDBStatsCollector function
+// documentation for details.
+package sqlstat
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+func init() {
+	metrics.MustHelp("go_sql_max_open_connections", "Maximum number of open connections to the database.")
+	metrics.MustHelp("go_sql_open_connections", "The number of established connections both in use and idle.")
+	metrics.MustHelp("go_sql_in_use_connections", "The number of connections currently in use.")
+	metrics.MustHelp("go_sql_idle_connections", "The number of idle connections.")
+	metrics.MustHelp("go_sql_wait_count_total", "The total number of connections waited for.")
+	metrics.MustHelp("go_sql_wait_duration_seconds_total", "The total time blocked waiting for a new connection.")
+	metrics.MustHelp("go_sql_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.")
+	metrics.MustHelp("go_sql_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.")
+	metrics.MustHelp("go_sql_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.")
+}
+
+// Connection Pool Samples
+var (
+	MaxOpenConnections = metrics.Must1LabelRealSample("go_sql_max_open_connections", "db")
+	OpenConnections    = metrics.Must1LabelRealSample("go_sql_open_connections", "db")
+	InUse              = metrics.Must1LabelRealSample("go_sql_in_use_connections", "db")
+	Idle               = metrics.Must1LabelRealSample("go_sql_idle_connections", "db")
+	WaitCount          = metrics.Must1LabelCounterSample("go_sql_wait_count_total", "db")
+	WaitDuration       = metrics.Must1LabelCounterSample("go_sql_wait_duration_seconds_total", "db")
+	MaxIdleClosed      = metrics.Must1LabelCounterSample("go_sql_max_idle_closed_total", "db")
+	MaxIdleTimeClosed  = metrics.Must1LabelCounterSample("go_sql_max_idle_time_closed_total", "db")
+	MaxLifetimeClosed  = metrics.Must1LabelCounterSample("go_sql_max_lifetime_closed_total", "db")
+)
+
+// Capture updates the samples of db, with name as the label value.
+func Capture(db *sql.DB, name string) {
+	stats := db.Stats()
+	timestamp := time.Now()
+
+	MaxOpenConnections(name).Set(float64(stats.MaxOpenConnections), timestamp)
+	OpenConnections(name).Set(float64(stats.OpenConnections), timestamp)
+	InUse(name).Set(float64(stats.InUse), timestamp)
+	Idle(name).Set(float64(stats.Idle), timestamp)
+	WaitCount(name).Set(float64(stats.WaitCount), timestamp)
+	WaitDuration(name).SetSeconds(stats.WaitDuration, timestamp)
+	MaxIdleClosed(name).Set(float64(stats.MaxIdleClosed), timestamp)
+	MaxIdleTimeClosed(name).Set(float64(stats.MaxIdleTimeClosed), timestamp)
+	MaxLifetimeClosed(name).Set(float64(stats.MaxLifetimeClosed), timestamp)
+}
+
+// CaptureEvery updates the samples of each database with an interval,
+// starting now. The map keys are used as label values, and the map should
+// not be modified after the call. The routine terminates with a send or
+// close on cancel.
+func CaptureEvery(interval time.Duration, dbs map[string]*sql.DB) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		captureAll(dbs)
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				captureAll(dbs)
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func captureAll(dbs map[string]*sql.DB) {
+	for name, db := range dbs {
+		Capture(db, name)
+	}
+}
@@ -0,0 +1,90 @@
+package sqlstat
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// VoidDriver establishes connections without any functionality.
+type voidDriver struct{}
+
+func (voidDriver) Open(name string) (driver.Conn, error) { return voidConn{}, nil }
+
+type voidConn struct{}
+
+func (voidConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("void") }
+func (voidConn) Close() error                              { return nil }
+func (voidConn) Begin() (driver.Tx, error)                 { return nil, errors.New("void") }
+
+func init() {
+	sql.Register("sqlstat-void", voidDriver{})
+}
+
+func TestCapture(t *testing.T) {
+	db1, err := sql.Open("sqlstat-void", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.Close()
+	db1.SetMaxOpenConns(7)
+	if err := db1.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	db2, err := sql.Open("sqlstat-void", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	Capture(db1, "primary")
+	Capture(db2, "replica")
+
+	metrics.SkipTimestamp = true
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	got := buf.String()
+
+	for _, want := range []string{
+		"\n# TYPE go_sql_max_open_connections gauge\n",
+		"\ngo_sql_max_open_connections{db=\"primary\"} 7\n",
+		"\ngo_sql_max_open_connections{db=\"replica\"} 0\n",
+		"\ngo_sql_open_connections{db=\"primary\"} 1\n",
+		"\ngo_sql_idle_connections{db=\"primary\"} 1\n",
+		"\ngo_sql_in_use_connections{db=\"primary\"} 0\n",
+		"\n# TYPE go_sql_wait_duration_seconds_total counter\n",
+		"\ngo_sql_wait_duration_seconds_total{db=\"replica\"} 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestCaptureEvery(t *testing.T) {
+	db, err := sql.Open("sqlstat-void", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+
+	cancel := CaptureEvery(time.Hour, map[string]*sql.DB{"every": db})
+	// The routine receives cancel after the first capture only.
+	cancel <- struct{}{}
+
+	value, timestamp := MaxOpenConnections("every").Get()
+	if timestamp == 0 {
+		t.Fatal("no capture before cancel")
+	}
+	if value != 3 {
+		t.Errorf("got max open connections %g, want 3", value)
+	}
+}
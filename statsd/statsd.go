@@ -0,0 +1,317 @@
+// Package statsd provides metric exports in the StatsD format, with optional
+// support for the DogStatsD extension of tags.
+package statsd
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+	"github.com/pascaldekloe/metrics/internal/flatten"
+)
+
+// DefaultMaxPacketSize fits an Ethernet frame (with an MTU of 1500 bytes),
+// including the IP and UDP headers.
+const DefaultMaxPacketSize = 1432
+
+// Exporter sends the content of a Register in the StatsD format. Counters
+// are sent as increments since the previous export. Gauges are sent with
+// their current value. Histograms are sent as observations since the previous
+// export, at the upper bound of their respective bucket, with a sample rate
+// for the number of observations. The histogram type ("h") is exclusive to
+// DogStatsD. Plain StatsD gets timers ("ms") instead, with the values in
+// milliseconds, i.e., histograms are expected in seconds, as Prometheus names
+// have them. Summaries are sent as gauges per quantile, plus counters for the
+// count and the sum of observations. Multiple goroutines may invoke methods on
+// an Exporter simultaneously.
+type Exporter struct {
+	// Prefix is prepended to each metric name, e.g., "myapp.".
+	Prefix string
+
+	// Tags enables the DogStatsD extension, with labels as tags.
+	// Otherwise, label values are appended to the metric name,
+	// in order of label name, with a dot separator each.
+	Tags bool
+
+	// MaxPacketSize limits the number of bytes per write.
+	// The zero value defaults to DefaultMaxPacketSize.
+	MaxPacketSize int
+
+	reg *metrics.Register
+	w   io.Writer
+
+	mutex sync.Mutex
+	// counter readings from the previous export per series key
+	counters map[string]float64
+	// histogram readings from the previous export per series key
+	histograms map[string][]uint64
+	// reusable buffers
+	packet, line []byte
+}
+
+// NewExporter returns a new Exporter which sends the content of reg to w,
+// typically a UDP connection from net.Dial. A nil reg defaults to the
+// default register of the metrics package.
+func NewExporter(reg *metrics.Register, w io.Writer) *Exporter {
+	return &Exporter{
+		reg:        reg,
+		w:          w,
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]uint64),
+	}
+}
+
+// Export sends a snapshot. Lines are batched into packets, within the limits
+// of MaxPacketSize. The first write error is returned, if any, yet all packets
+// are attempted regardless.
+func (e *Exporter) Export() error {
+	var families []metrics.Family
+	if e.reg == nil {
+		families = metrics.Snapshot()
+	} else {
+		families = e.reg.Snapshot()
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var firstErr error
+	flush := func() {
+		if len(e.packet) == 0 {
+			return
+		}
+		if _, err := e.w.Write(e.packet); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		e.packet = e.packet[:0]
+	}
+	maxSize := e.MaxPacketSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPacketSize
+	}
+	emit := func() {
+		if len(e.packet) != 0 && len(e.packet)+1+len(e.line) > maxSize {
+			flush()
+		}
+		if len(e.packet) != 0 {
+			e.packet = append(e.packet, '\n')
+		}
+		e.packet = append(e.packet, e.line...)
+	}
+
+	for _, f := range families {
+		for _, s := range f.Series {
+			key := seriesKey(f.Name, s.Labels)
+
+			switch f.Type {
+			case "counter":
+				if delta := e.counterDelta(key, s.Value); delta != 0 {
+					e.appendLine(f.Name, s.Labels, "", delta, "c", 1)
+					emit()
+				}
+
+			case "gauge":
+				if s.Value < 0 {
+					// negative values are relative changes
+					e.appendLine(f.Name, s.Labels, "", 0, "g", 1)
+					emit()
+				}
+				e.appendLine(f.Name, s.Labels, "", s.Value, "g", 1)
+				emit()
+
+			case "histogram":
+				typ := "ms"
+				if e.Tags {
+					typ = "h"
+				}
+				for i, n := range e.histogramDeltas(key, s) {
+					if n == 0 {
+						continue
+					}
+					var value float64
+					switch {
+					case i < len(s.BucketBounds):
+						value = s.BucketBounds[i]
+					case len(s.BucketBounds) != 0:
+						value = s.BucketBounds[len(s.BucketBounds)-1]
+					case s.Count != 0:
+						value = s.Sum / float64(s.Count)
+					}
+					if !e.Tags {
+						value *= 1000 // milliseconds
+					}
+					e.appendLine(f.Name, s.Labels, "", value, typ, n)
+					emit()
+				}
+
+			case "summary":
+				for i, q := range s.Quantiles {
+					e.appendLine(f.Name, s.Labels, strconv.FormatFloat(q, 'g', -1, 64), s.QuantileValues[i], "g", 1)
+					emit()
+				}
+				if delta := e.counterDelta(key+"\x00count", float64(s.Count)); delta != 0 {
+					e.appendLine(f.Name+"_count", s.Labels, "", delta, "c", 1)
+					emit()
+				}
+				if delta := e.counterDelta(key+"\x00sum", s.Sum); delta != 0 {
+					e.appendLine(f.Name+"_sum", s.Labels, "", delta, "c", 1)
+					emit()
+				}
+			}
+		}
+	}
+	flush()
+
+	return firstErr
+}
+
+// ExportEvery sends a snapshot with an interval, starting now. Errors are
+// ignored. The routine terminates with a send or close on cancel.
+func (e *Exporter) ExportEvery(interval time.Duration) (cancel chan<- struct{}) {
+	ch := make(chan struct{})
+
+	go func() {
+		e.Export()
+
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				e.Export()
+
+			case <-ch:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// CounterDelta returns the increment since the previous export.
+func (e *Exporter) counterDelta(key string, value float64) float64 {
+	last := e.counters[key]
+	e.counters[key] = value
+	if value < last {
+		// reset
+		return value
+	}
+	return value - last
+}
+
+// HistogramDeltas returns the observations since the previous export for each
+// bucket, including the positive infinity one.
+func (e *Exporter) histogramDeltas(key string, s metrics.Series) []uint64 {
+	current := make([]uint64, len(s.Buckets)+1)
+	copy(current, s.Buckets)
+	inf := s.Count
+	for _, n := range s.Buckets {
+		inf -= n
+	}
+	current[len(s.Buckets)] = inf
+
+	last := e.histograms[key]
+	e.histograms[key] = current
+
+	deltas := make([]uint64, len(current))
+	for i, n := range current {
+		if i < len(last) && last[i] <= n {
+			deltas[i] = n - last[i]
+		} else {
+			deltas[i] = n
+		}
+	}
+	return deltas
+}
+
+// SeriesKey returns a unique identifier.
+func seriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var buf strings.Builder
+	buf.WriteString(name)
+	for _, label := range flatten.SortedLabelNames(labels) {
+		buf.WriteByte(0)
+		buf.WriteString(label)
+		buf.WriteByte(0)
+		buf.WriteString(labels[label])
+	}
+	return buf.String()
+}
+
+// AppendLine sets the line buffer. The quantile is optional.
+func (e *Exporter) appendLine(name string, labels map[string]string, quantile string, value float64, typ string, n uint64) {
+	line := append(e.line[:0], e.Prefix...)
+	line = append(line, name...)
+
+	names := flatten.SortedLabelNames(labels)
+	if !e.Tags {
+		for _, label := range names {
+			line = append(line, '.')
+			line = appendSanitized(line, labels[label], true)
+		}
+		if quantile != "" {
+			line = append(line, ".quantile_"...)
+			line = appendSanitized(line, quantile, true)
+		}
+	}
+
+	line = append(line, ':')
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		value = 0 // not supported
+	}
+	line = strconv.AppendFloat(line, value, 'g', -1, 64)
+	line = append(line, '|')
+	line = append(line, typ...)
+	if n > 1 {
+		line = append(line, "|@"...)
+		line = strconv.AppendFloat(line, 1/float64(n), 'g', -1, 64)
+	}
+
+	if e.Tags && (len(names) != 0 || quantile != "") {
+		line = append(line, "|#"...)
+		for i, label := range names {
+			if i != 0 {
+				line = append(line, ',')
+			}
+			line = append(line, label...)
+			line = append(line, ':')
+			line = appendSanitized(line, labels[label], false)
+		}
+		if quantile != "" {
+			if len(names) != 0 {
+				line = append(line, ',')
+			}
+			line = append(line, "quantile:"...)
+			line = append(line, quantile...)
+		}
+	}
+
+	e.line = line
+}
+
+// AppendSanitized replaces characters with a special meaning in the protocol
+// with an underscore.
+func appendSanitized(buf []byte, s string, dots bool) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ':', '|', '@', ',', '#', '\n', '\r', ' ':
+			buf = append(buf, '_')
+		case '.':
+			if dots {
+				buf = append(buf, '_')
+			} else {
+				buf = append(buf, c)
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
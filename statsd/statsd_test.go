@@ -0,0 +1,142 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// Listen returns a local UDP listener with a connection to it.
+func listen(t *testing.T) (server net.PacketConn, client net.Conn) {
+	t.Helper()
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("UDP listener unavailable:", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err = net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal("UDP dial:", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// ReadPackets returns the payload of each packet until a read timeout.
+func readPackets(t *testing.T, server net.PacketConn) []string {
+	t.Helper()
+	var packets []string
+	buf := make([]byte, 64*1024)
+	for {
+		server.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return packets
+			}
+			t.Fatal("UDP read:", err)
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func TestExport(t *testing.T) {
+	server, client := listen(t)
+
+	reg := metrics.NewRegister()
+	c := reg.Must1LabelCounter("hits_total", "path")("/a.b")
+	g := reg.MustInteger("temperature", "")
+	h := reg.MustHistogram("latency_seconds", "", 0.1, 1)
+	exp := NewExporter(reg, client)
+	exp.Prefix = "app."
+
+	c.Add(3)
+	g.Set(-4)
+	h.Add(0.05)
+	h.Add(0.05)
+	h.Add(5)
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	want := []string{
+		"app.hits_total./a_b:3|c",
+		"app.temperature:0|g",
+		"app.temperature:-4|g",
+		"app.latency_seconds:100|ms|@0.5",
+		"app.latency_seconds:1000|ms",
+	}
+	packets := readPackets(t, server)
+	if got := strings.Join(packets, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got packets %q, want lines %q", packets, want)
+	}
+
+	// deltas only
+	c.Add(2)
+	h.Add(0.5)
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	want = []string{
+		"app.hits_total./a_b:2|c",
+		"app.temperature:0|g",
+		"app.temperature:-4|g",
+		"app.latency_seconds:1000|ms",
+	}
+	packets = readPackets(t, server)
+	if got := strings.Join(packets, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got packets %q, want lines %q", packets, want)
+	}
+}
+
+func TestExportTags(t *testing.T) {
+	server, client := listen(t)
+
+	reg := metrics.NewRegister()
+	reg.Must2LabelCounter("requests_total", "method", "code")("GET", "2|0").Add(1)
+	reg.MustSummarySample("gc_seconds", "", 0.5).Set([]float64{0.25}, 4, 1, time.Now())
+	reg.MustHistogram("latency_seconds", "", 0.1).Add(0.05)
+	exp := NewExporter(reg, client)
+	exp.Tags = true
+
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	want := []string{
+		"requests_total:1|c|#code:2_0,method:GET",
+		"gc_seconds:0.25|g|#quantile:0.5",
+		"gc_seconds_count:4|c",
+		"gc_seconds_sum:1|c",
+		"latency_seconds:0.1|h",
+	}
+	packets := readPackets(t, server)
+	if got := strings.Join(packets, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got packets %q, want lines %q", packets, want)
+	}
+}
+
+func TestExportBatch(t *testing.T) {
+	server, client := listen(t)
+
+	reg := metrics.NewRegister()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		reg.MustInteger(name+"_gauge", "").Set(1)
+	}
+	exp := NewExporter(reg, client)
+	exp.MaxPacketSize = len("a_gauge:1|g\nb_gauge:1|g")
+
+	if err := exp.Export(); err != nil {
+		t.Fatal("export error:", err)
+	}
+	want := []string{
+		"a_gauge:1|g\nb_gauge:1|g",
+		"c_gauge:1|g\nd_gauge:1|g",
+		"e_gauge:1|g",
+	}
+	got := readPackets(t, server)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got packets %q, want %q", got, want)
+	}
+}
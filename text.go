@@ -3,6 +3,7 @@ package metrics
 import (
 	"io"
 	"net/http"
+	"path"
 	"strconv"
 	"time"
 )
@@ -12,6 +13,18 @@ import (
 // time and Samples provide their own time.
 var SkipTimestamp = false
 
+// HistogramMaxAge and HistogramMaxWait apply to Histogram reads from
+// serialisation and snapshots, as with Histogram.GetRecent. Histograms which
+// stall on the wait limit are omitted from the output, as opposed to serving
+// an outdated read. The text output omits the TYPE and HELP comments as well
+// when each histogram of a family stalls. The zero values have no reuse of
+// reads from before the serialisation started, and no wait limit. Both must
+// be set before use, like SkipTimestamp, as changes are not synchronised.
+var (
+	HistogramMaxAge  time.Duration
+	HistogramMaxWait time.Duration
+)
+
 const headerLine = "# Prometheus Samples\n"
 
 // ServeHTTP provides a sample of each metric as an http.HandlerFunc.
@@ -20,6 +33,11 @@ func ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 }
 
 // ServeHTTP provides a sample of each metric as an http.Handler.
+// Any name[] query parameters limit the selection to metric names
+// which match at least one of them. The patterns follow path.Match,
+// such that "http_requests_total" is an exact match, and such that
+// "http_*" matches each name with an "http_" prefix. Clients which prefer
+// "application/json" in their Accept header get the WriteJSON format.
 func (reg *Register) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet && req.Method != http.MethodHead {
 		resp.Header().Set("Allow", http.MethodOptions+", "+http.MethodGet+", "+http.MethodHead)
@@ -30,8 +48,31 @@ func (reg *Register) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	var filter func(name string) bool
+	if patterns := req.URL.Query()["name[]"]; len(patterns) != 0 {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				http.Error(resp, "malformed name[] pattern "+strconv.Quote(p), http.StatusBadRequest)
+				return
+			}
+		}
+		filter = func(name string) bool {
+			for _, p := range patterns {
+				if ok, _ := path.Match(p, name); ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if acceptsJSON(req.Header.Get("Accept")) {
+		resp.Header().Set("Content-Type", "application/json")
+		reg.writeFilteredJSON(resp, filter)
+		return
+	}
 	resp.Header().Set("Content-Type", "text/plain;version=0.0.4")
-	reg.WriteTo(resp)
+	reg.WriteFilteredTo(resp, filter)
 }
 
 // WriteText serialises a sample of each metric in a simple text
@@ -57,6 +98,36 @@ func WriteTo(w io.Writer) (n int64, err error) {
 // WriteTo serialises a sample of each metric in a simple text
 // format as an io.WriterTo.
 func (reg *Register) WriteTo(w io.Writer) (n int64, err error) {
+	return reg.WriteFilteredTo(w, nil)
+}
+
+// WriteFilteredTo serialises a sample of each metric with a name accepted by
+// filter, in the same format as WriteTo. A nil filter accepts all names.
+func WriteFilteredTo(w io.Writer, filter func(name string) bool) (n int64, err error) {
+	return std.WriteFilteredTo(w, filter)
+}
+
+// WriteFilteredTo serialises a sample of each metric with a name accepted by
+// filter, in the same format as WriteTo. A nil filter accepts all names.
+func (reg *Register) WriteFilteredTo(w io.Writer, filter func(name string) bool) (n int64, err error) {
+	return reg.writeTo(w, filter, SkipTimestamp)
+}
+
+// WriteUntimedTo serialises a sample of each metric in the same format as
+// WriteTo, yet without any timestamps regardless of SkipTimestamp, as the
+// Pushgateway requires.
+func WriteUntimedTo(w io.Writer) (n int64, err error) {
+	return std.WriteUntimedTo(w)
+}
+
+// WriteUntimedTo serialises a sample of each metric in the same format as
+// WriteTo, yet without any timestamps regardless of SkipTimestamp, as the
+// Pushgateway requires.
+func (reg *Register) WriteUntimedTo(w io.Writer) (n int64, err error) {
+	return reg.writeTo(w, nil, true)
+}
+
+func (reg *Register) writeTo(w io.Writer, filter func(name string) bool, skipTimestamp bool) (n int64, err error) {
 	wn, err := io.WriteString(w, headerLine)
 	n = int64(wn)
 	if err != nil {
@@ -70,91 +141,17 @@ func (reg *Register) WriteTo(w io.Writer) (n int64, err error) {
 	defer reg.mutex.RUnlock()
 
 	// serialise samples in order of appearance
-	for _, m := range reg.metrics {
+	var instances []instance
+	for _, m := range reg.selection(filter) {
 		buf = append(buf, m.comments...)
-
-		switch m.typeID {
-		case counterID:
-			if m.counter != nil {
-				buf = append(buf, m.counter.prefix...)
-				buf = strconv.AppendUint(buf, m.counter.Get(), 10)
-				buf = appendTimestamp(buf)
-			}
-
-			for _, l := range m.labels {
-				l.Lock()
-				view := l.counters
-				l.Unlock()
-				for _, v := range view {
-					buf = append(buf, v.prefix...)
-					buf = strconv.AppendUint(buf, v.Get(), 10)
-					buf = appendTimestamp(buf)
-				}
-			}
-
-		case integerID:
-			if m.integer != nil {
-				buf = append(buf, m.integer.prefix...)
-				buf = strconv.AppendInt(buf, m.integer.Get(), 10)
-				buf = appendTimestamp(buf)
-			}
-
-			for _, l := range m.labels {
-				l.Lock()
-				view := l.integers
-				l.Unlock()
-				for _, v := range view {
-					buf = append(buf, v.prefix...)
-					buf = strconv.AppendInt(buf, v.Get(), 10)
-					buf = appendTimestamp(buf)
-				}
-			}
-
-		case realID:
-			if m.real != nil {
-				buf = append(buf, m.real.prefix...)
-				buf = strconv.AppendFloat(buf, m.real.Get(), 'g', -1, 64)
-				buf = appendTimestamp(buf)
-			}
-
-			for _, l := range m.labels {
-				l.Lock()
-				view := l.reals
-				l.Unlock()
-				for _, v := range view {
-					buf = append(buf, v.prefix...)
-					buf = strconv.AppendFloat(buf, v.Get(), 'g', -1, 64)
-					buf = appendTimestamp(buf)
-				}
-			}
-
-		case counterSampleID, realSampleID:
-			if m.sample != nil {
-				buf = m.sample.append(buf)
-			}
-
-			for _, l := range m.labels {
-				l.Lock()
-				view := l.samples
-				l.Unlock()
-				for _, v := range view {
-					buf = v.append(buf)
-				}
-			}
-
-		case histogramID:
-			if m.histogram != nil {
-				buf = m.histogram.append(buf)
-			}
-
-			for _, l := range m.labels {
-				l.Lock()
-				view := l.histograms
-				l.Unlock()
-				for _, v := range view {
-					buf = v.append(buf)
-				}
-			}
+		instances = m.appendInstances(instances[:0])
+		for _, v := range instances {
+			buf = v.append(buf, skipTimestamp)
+		}
+		if m.typeID == histogramID && len(instances) != 0 && len(buf) == len(m.comments) {
+			// each histogram stalled
+			buf = buf[:0]
+			continue
 		}
 
 		wn, err = w.Write(buf)
@@ -168,11 +165,47 @@ func (reg *Register) WriteTo(w io.Writer) (n int64, err error) {
 	return n, nil
 }
 
-func (m *Sample) append(buf []byte) []byte {
+func (m *Counter) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendUint(buf, m.Get(), 10)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *Integer) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendInt(buf, m.Get(), 10)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *Real) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendFloat(buf, m.Get(), 'g', -1, 64)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *RealCounter) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendFloat(buf, m.Get(), 'g', -1, 64)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *ShardedCounter) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendUint(buf, m.Get(), 10)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *ShardedInteger) append(buf []byte, skipTimestamp bool) []byte {
+	buf = append(buf, m.prefix...)
+	buf = strconv.AppendInt(buf, m.Get(), 10)
+	return appendTimestamp(buf, skipTimestamp)
+}
+
+func (m *Sample) append(buf []byte, skipTimestamp bool) []byte {
 	if value, timestamp := m.Get(); timestamp != 0 {
 		buf = append(buf, m.prefix...)
 		buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
-		if !SkipTimestamp {
+		if !skipTimestamp {
 			buf = append(buf, ' ')
 			buf = strconv.AppendUint(buf, timestamp, 10)
 		}
@@ -181,22 +214,79 @@ func (m *Sample) append(buf []byte) []byte {
 	return buf
 }
 
-func (h *Histogram) append(buf []byte) []byte {
+func (m *SummarySample) append(buf []byte, skipTimestamp bool) []byte {
+	var stack [5]float64
+	values, count, sum, timestamp := m.Get(stack[:0])
+	if timestamp == 0 {
+		return buf
+	}
+
+	var timestampBuf [maxUint64Text + 2]byte
+	timestampSerial := timestampBuf[:0]
+	if !skipTimestamp {
+		timestampSerial = append(timestampSerial, ' ')
+		timestampSerial = strconv.AppendUint(timestampSerial, timestamp, 10)
+	}
+	timestampSerial = append(timestampSerial, '\n')
+
+	for i, prefix := range m.quantilePrefixes {
+		buf = append(buf, prefix...)
+		buf = strconv.AppendFloat(buf, values[i], 'g', -1, 64)
+		buf = append(buf, timestampSerial...)
+	}
+	buf = append(buf, m.sumPrefix...)
+	buf = strconv.AppendFloat(buf, sum, 'g', -1, 64)
+	buf = append(buf, timestampSerial...)
+	buf = append(buf, m.countPrefix...)
+	buf = strconv.AppendUint(buf, count, 10)
+	buf = append(buf, timestampSerial...)
+
+	return buf
+}
+
+func (h *Histogram) append(buf []byte, skipTimestamp bool) []byte {
 	var stack [7]uint64
-	buckets, count, sum := h.Get(stack[:0])
+	buckets, count, sum, err := h.GetRecent(stack[:0], HistogramMaxAge, HistogramMaxWait)
+	if err != nil {
+		return buf // omit stall
+	}
 
-	buf = append(buf, h.countPrefix...)
+	var timestampBuf [maxInt64Text + 2]byte
+	timestamp := appendTimestamp(timestampBuf[:0], skipTimestamp)
+
+	return appendHistogram(buf, h.bucketPrefixes, h.countPrefix, h.sumPrefix, buckets, count, sum, timestamp)
+}
+
+func (m *HistogramSample) append(buf []byte, skipTimestamp bool) []byte {
+	var stack [7]uint64
+	buckets, count, sum, timestamp := m.Get(stack[:0])
+	if timestamp == 0 {
+		return buf
+	}
+
+	var timestampBuf [maxUint64Text + 2]byte
+	timestampSerial := timestampBuf[:0]
+	if !skipTimestamp {
+		timestampSerial = append(timestampSerial, ' ')
+		timestampSerial = strconv.AppendUint(timestampSerial, timestamp, 10)
+	}
+	timestampSerial = append(timestampSerial, '\n')
+
+	return appendHistogram(buf, m.bucketPrefixes, m.countPrefix, m.sumPrefix, buckets, count, sum, timestampSerial)
+}
+
+// AppendHistogram serialises the count, each bucket and the sum. The
+// timestamp serial is appended to each line, including the line feed.
+func appendHistogram(buf []byte, bucketPrefixes []string, countPrefix, sumPrefix string, buckets []uint64, count uint64, sum float64, timestamp []byte) []byte {
+	buf = append(buf, countPrefix...)
 	offset := len(buf)
 	buf = strconv.AppendUint(buf, count, 10)
 	countSerial := buf[offset:]
-
-	timeOffset := len(buf)
-	buf = appendTimestamp(buf)
-	timestamp := buf[timeOffset:]
+	buf = append(buf, timestamp...)
 
 	// buckets
 	var cum uint64
-	for i, prefix := range h.bucketPrefixes {
+	for i, prefix := range bucketPrefixes {
 		if i >= len(buckets) {
 			// (redundant) +Inf bucket
 			buf = append(buf, prefix...)
@@ -212,15 +302,15 @@ func (h *Histogram) append(buf []byte) []byte {
 	}
 
 	// sum
-	buf = append(buf, h.sumPrefix...)
+	buf = append(buf, sumPrefix...)
 	buf = strconv.AppendFloat(buf, sum, 'g', -1, 64)
 	buf = append(buf, timestamp...)
 
 	return buf
 }
 
-func appendTimestamp(buf []byte) []byte {
-	if !SkipTimestamp {
+func appendTimestamp(buf []byte, skipTimestamp bool) []byte {
+	if !skipTimestamp {
 		buf = append(buf, ' ')
 		ms := time.Now().UnixNano() / 1e6
 		buf = strconv.AppendInt(buf, ms, 10)
@@ -50,6 +50,34 @@ v{sign="π"} 3.141592653589793
 	}
 }
 
+func TestWriteUntimedTo(t *testing.T) {
+	metrics.SkipTimestamp = false
+	defer func() { metrics.SkipTimestamp = true }()
+	reg := metrics.NewRegister()
+	reg.MustCounter("c", "").Add(1)
+	reg.MustRealSample("s", "").Set(2, time.UnixMilli(1615130567389))
+
+	var buf bytes.Buffer
+	n, err := reg.WriteUntimedTo(&buf)
+	if err != nil {
+		t.Fatal("got error:", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("n = %d with %d bytes written", n, buf.Len())
+	}
+	const want = `# Prometheus Samples
+
+# TYPE c counter
+c 1
+
+# TYPE s gauge
+s 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	metrics.SkipTimestamp = true
 	reg := metrics.NewRegister()
@@ -88,6 +116,58 @@ m2 9
 	}
 }
 
+func TestServeHTTPNameFilter(t *testing.T) {
+	metrics.SkipTimestamp = true
+	reg := metrics.NewRegister()
+	reg.MustCounter("http_requests_total", "").Add(3)
+	reg.MustInteger("http_requests_in_flight", "").Set(1)
+	reg.MustReal("db_load_ratio", "").Set(0.5)
+	reg.Must1LabelCounter("db_queries_total", "table")("user").Add(7)
+
+	golden := []struct {
+		query string
+		want  string
+	}{
+		{"name[]=http_requests_total", `# Prometheus Samples
+
+# TYPE http_requests_total counter
+http_requests_total 3
+`},
+		{"name[]=http_*", `# Prometheus Samples
+
+# TYPE http_requests_total counter
+http_requests_total 3
+
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 1
+`},
+		{"name[]=db_queries_total&name[]=http_requests_in_flight", `# Prometheus Samples
+
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 1
+
+# TYPE db_queries_total counter
+db_queries_total{table="user"} 7
+`},
+		{"name[]=nope", "# Prometheus Samples\n"},
+	}
+
+	for _, gold := range golden {
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics?"+gold.query, nil))
+		if got := rec.Body.String(); got != gold.want {
+			t.Errorf("%s: got %q", gold.query, got)
+			t.Errorf("%s: want %q", gold.query, gold.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics?name[]=%5B", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed pattern got status code %d, want 400", rec.Code)
+	}
+}
+
 func TestHTTPMethods(t *testing.T) {
 	rec := httptest.NewRecorder()
 	metrics.NewRegister().ServeHTTP(rec, httptest.NewRequest("POST", "/metrics", nil))